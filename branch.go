@@ -11,7 +11,7 @@ type branch struct {
 	*config.Branch
 }
 
-func newBranch(r *repository, b *config.Branch) Branch {
+func newBranch(r *repository, b *config.Branch) *branch {
 	t := &branch{Branch: b}
 	t.base = base{r: r, getRefSpecs: t.getRefSpecs}
 	return t
@@ -25,7 +25,26 @@ func (b *branch) getRefSpecs() []config.RefSpec {
 	return []config.RefSpec{}
 }
 
-func (b *branch) Delete(ctx context.Context) error {
+func (b *branch) Delete(ctx context.Context) (err error) {
+	defer b.r.lock()()
+	defer b.r.acquire(ctx, &err)()
+	if err != nil {
+		return
+	}
+	err = b.delete(ctx)
+	return
+}
+
+// delete 删除本地分支并标记为删除，dry run时保留本地分支，仅在Push时输出将要删除的远端分支
+func (b *branch) delete(ctx context.Context) error {
+	if b.r.h.GetDryRun() {
+		return b.base.Delete(ctx)
+	}
+	return b.deleteLocal(ctx)
+}
+
+// deleteLocal 删除本地分支并标记为删除
+func (b *branch) deleteLocal(ctx context.Context) error {
 	err := b.r.Repository.DeleteBranch(b.Name)
 	if err == nil {
 		err = b.r.Storer.RemoveReference(b.Merge)
@@ -0,0 +1,86 @@
+package gittools
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// cacheName url在CacheDir中对应的目录名，由仓库名以及url的hash组成
+func cacheName(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	name := strings.TrimSuffix(path.Base(strings.TrimRight(strings.ReplaceAll(url, ":", "/"), "/")), ".git")
+	return fmt.Sprintf("%s-%s.git", name, hex.EncodeToString(sum[:8]))
+}
+
+// cacheLockSuffix 缓存目录的文件锁位于缓存目录旁，缓存目录不存在时也可以加锁
+const cacheLockSuffix = ".lock"
+
+// cacheMirror 返回url在CacheDir中的bare mirror，不存在则mirror clone，存在则fetch更新
+func (h *cloner) cacheMirror(ctx context.Context, url string, auth transport.AuthMethod) (dir string, err error) {
+	dir = filepath.Join(h.GetCacheDir(), cacheName(url))
+	defer func(start time.Time) {
+		h.done(start, &err, "cache", Field{FieldURL, redactURL(url)}, Field{"dir", dir})
+	}(time.Now())
+	// CacheDir可能被多个进程共享，同一缓存目录的clone以及fetch通过文件锁串行
+	if err = os.MkdirAll(h.GetCacheDir(), 0755); err != nil {
+		return
+	}
+	var unlock func()
+	if unlock, err = h.waitFileLock(ctx, dir+cacheLockSuffix); err != nil {
+		return
+	}
+	defer unlock()
+	var r *git.Repository
+	if r, err = git.PlainOpen(dir); err == git.ErrRepositoryNotExists {
+		if err = h.retry(ctx, "cache clone", func() error {
+			_, err0 := git.PlainCloneContext(h.metered(ctx, "cache clone"), dir, true, &git.CloneOptions{
+				URL:      url,
+				Auth:     auth,
+				Progress: h.progress(ctx, "cache clone"),
+				Mirror:   true,
+			})
+			return err0
+		}); err != nil {
+			_ = os.RemoveAll(dir)
+		}
+		return
+	} else if err != nil {
+		return
+	}
+	err = checkErr(h.retry(ctx, "cache fetch", func() error {
+		return r.FetchContext(h.metered(ctx, "cache fetch"), &git.FetchOptions{
+			RemoteName: DefaultRemoteName,
+			RefSpecs:   []config.RefSpec{mirrorRefSpec},
+			Auth:       auth,
+			Progress:   h.progress(ctx, "cache fetch"),
+			Tags:       git.AllTags,
+			Prune:      true,
+			Force:      true,
+		})
+	}))
+	return
+}
+
+// restoreOrigin 从缓存clone后，将origin指回真实的url
+func restoreOrigin(r *git.Repository, url string) error {
+	c, err := r.Config()
+	if err != nil {
+		return err
+	}
+	rc, ok := c.Remotes[DefaultRemoteName]
+	if !ok {
+		return ErrRemoteNotFound
+	}
+	rc.URLs = []string{url}
+	return r.SetConfig(c)
+}
@@ -0,0 +1,54 @@
+package gittools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	git "github.com/go-git/go-git/v5"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCacheDir(t *testing.T) {
+	Convey("clone from cache", t, func() {
+		ctx := context.Background()
+		g, upstream := newLocalRepository(t)
+		cacheDir := t.TempDir()
+		old := g.ApplyOption(WithCacheDir(cacheDir))
+		defer g.ApplyOption(old...)
+
+		r, err := g.Clone(ctx, upstream.Root(), "")
+		So(err, ShouldBeNil)
+		defer func() { _ = r.RemoveAll() }()
+		mirror, err := git.PlainOpen(filepath.Join(cacheDir, cacheName(upstream.Root())))
+		So(err, ShouldBeNil)
+		remotes, err := r.Remotes(ctx)
+		So(err, ShouldBeNil)
+		So(remotes, ShouldResemble, []Remote{{Name: DefaultRemoteName, URLs: []string{upstream.Root()}}})
+
+		So(upstream.RewriteFile(ctx, "README.md", []byte("v2")), ShouldBeNil)
+		So(upstream.Commit(ctx, "v2"), ShouldBeNil)
+		r2, err := g.Clone(ctx, upstream.Root(), "")
+		So(err, ShouldBeNil)
+		defer func() { _ = r2.RemoveAll() }()
+		So(r2.(*repository).headHash, ShouldEqual, upstream.(*repository).headHash)
+		head, err := mirror.Head()
+		So(err, ShouldBeNil)
+		So(head.Hash(), ShouldEqual, upstream.(*repository).headHash)
+
+		Convey("locked by another process", func() {
+			g.ApplyOption(WithLockTimeout(100 * time.Millisecond))
+			lockPath := filepath.Join(cacheDir, cacheName(upstream.Root())) + cacheLockSuffix
+			host, _ := os.Hostname()
+			data, _ := json.Marshal(lockInfo{PID: os.Getpid(), Host: host, Time: time.Now()})
+			So(ioutil.WriteFile(lockPath, data, 0644), ShouldBeNil)
+			defer func() { _ = os.Remove(lockPath) }()
+			_, err := g.Clone(ctx, upstream.Root(), "")
+			So(errors.Is(err, ErrLockTimeout), ShouldBeTrue)
+		})
+	})
+}
@@ -6,64 +6,43 @@ import (
 	"github.com/go-git/go-billy/v5/memfs"
 	git "github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
-	"github.com/go-git/go-git/v5/plumbing/protocol/packp/sideband"
 	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
 	"github.com/go-git/go-git/v5/storage/memory"
 	"github.com/sandwich-go/boost/xos"
 	"io/ioutil"
 	"os"
 	"path/filepath"
-	"strings"
+	"sync"
+	"time"
 )
 
-const (
-	successLogFlag = "☕️☕️☕️, success!"
-	failedLogFlag  = "🚫🚫🚫, failed!"
-	logPrefix      = "[git]"
+var (
+	defaultCloner     Cloner
+	defaultClonerOnce sync.Once
 )
 
-var defaultCloner Cloner
-
 type cloner struct {
+	mu         sync.Mutex
 	publicKeys *ssh.PublicKeys
 	ConfigInterface
 }
 
 func New(opts ...ConfigOption) Cloner { return &cloner{ConfigInterface: NewConfig(opts...)} }
 
+// Default 返回全局的Cloner，opts仅在首次调用时生效
 func Default(opts ...ConfigOption) Cloner {
-	if defaultCloner == nil {
-		defaultCloner = New(opts...)
-	}
+	defaultClonerOnce.Do(func() { defaultCloner = New(opts...) })
 	return defaultCloner
 }
 
-func (h *cloner) print(err error, v ...interface{}) {
-	if err != nil {
-		h.GetLogger().Println(append(append([]interface{}{logPrefix, failedLogFlag}, v...), "Error:", err)...)
-	} else {
-		// 若最后一位是字符串，并且以','结尾，则移除','
-		// 例如:
-		// 2022/10/25 19:07:05 [git] ☕️☕️☕️, success! checkout, branch: master, hash: 086e42373a2433101b52bf35ecf84e1df9445c3f,
-		// to:
-		// 2022/10/25 19:07:05 [git] ☕️☕️☕️, success! checkout, branch: master, hash: 086e42373a2433101b52bf35ecf84e1df9445c3f
-		v = append([]interface{}{logPrefix, successLogFlag}, v...)
-		if l := len(v); l > 0 {
-			if s, ok := v[l-1].(string); ok {
-				v[l-1] = strings.TrimSuffix(s, ",")
-			}
-		}
-		h.GetLogger().Println(v...)
-	}
-}
-
-func (h *cloner) auth() (*ssh.PublicKeys, error) {
+func (h *cloner) auth() (_ *ssh.PublicKeys, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
 	if h.publicKeys != nil {
 		return h.publicKeys, nil
 	}
-	var err error
 	var rsaPath string
-	defer func() { h.print(err, fmt.Sprintf("auth, path: %s", rsaPath)) }()
+	defer func(start time.Time) { h.done(start, &err, "auth", Field{"path", rsaPath}) }(time.Now())
 	if !filepath.IsAbs(h.GetRsaPath()) {
 		var home string
 		if home, err = os.UserHomeDir(); err == nil {
@@ -77,7 +56,7 @@ func (h *cloner) auth() (*ssh.PublicKeys, error) {
 	}
 	exists := xos.ExistsFile(rsaPath)
 	if !exists {
-		err = fmt.Errorf("not found rsa path")
+		err = fmt.Errorf("%w: %s", ErrAuthKeyNotFound, rsaPath)
 		return nil, err
 	}
 	var buf []byte
@@ -102,78 +81,183 @@ func (h *cloner) checkConfig(r *git.Repository) error {
 	return r.SetConfig(c)
 }
 
-func (h *cloner) getProgress() sideband.Progress {
-	return h.GetLogger().Writer()
-}
+type cloneMode int
 
-func (h *cloner) clone(ctx context.Context, url, dir, branch string) (Repository, error) {
-	publicKeys, err := h.auth()
+const (
+	// cloneModeWorktree 带有工作区的克隆
+	cloneModeWorktree cloneMode = iota
+	// cloneModeBare git clone --bare
+	cloneModeBare
+	// cloneModeMirror git clone --mirror
+	cloneModeMirror
+)
+
+func (h *cloner) clone(ctx context.Context, url, dir, branch string, mode cloneMode) (Repository, error) {
+	ctx, cancel := withTimeout(ctx, h.GetCloneTimeout())
+	defer cancel()
+	auth, err := h.authForURL(url)
 	if err != nil {
 		return nil, err
 	}
 	var r *git.Repository
 	var opts = &git.CloneOptions{
 		URL:      url,
-		Auth:     publicKeys,
-		Progress: h.getProgress(),
+		Auth:     auth,
+		Progress: h.progress(ctx, "clone"),
 	}
 	if len(branch) > 0 {
 		opts.ReferenceName = getBranchReferenceName(branch)
-	} else {
+	} else if mode != cloneModeMirror {
 		opts.Depth = h.GetDepth()
 	}
-	if len(dir) == 0 {
-		r, err = git.CloneContext(ctx, memory.NewStorage(), memfs.New(), opts)
+	opts.Mirror = mode == cloneModeMirror
+	partial := len(h.GetFilter()) > 0
+	// sparse checkout或者partial clone时先不checkout，clone完成后仅获取并写出需要的文件
+	opts.NoCheckout = mode == cloneModeWorktree && (partial || len(h.GetSparsePaths()) > 0)
+	// partial clone需要服务端支持filter，不使用缓存
+	cached := len(h.GetCacheDir()) > 0 && !partial
+	if cached {
+		if opts.URL, err = h.cacheMirror(ctx, url, auth); err != nil {
+			return nil, err
+		}
+		opts.Auth = nil
+	}
+	if partial {
+		// partial clone获取对象时已按照RetryPolicy重试
+		r, err = h.partialClone(ctx, dir, mode, opts)
 	} else {
-		r, err = git.PlainCloneContext(ctx, dir, false, opts)
+		// go-git clone失败时会清理dir，因此可以直接重试
+		err = h.retry(ctx, "clone", func() (err0 error) {
+			if len(dir) == 0 {
+				r, err0 = git.CloneContext(h.metered(ctx, "clone"), memory.NewStorage(), memfs.New(), opts)
+			} else {
+				r, err0 = git.PlainCloneContext(h.metered(ctx, "clone"), dir, mode == cloneModeBare, opts)
+			}
+			return
+		})
 	}
 	if err != nil {
 		return nil, err
 	}
+	if cached {
+		if err = restoreOrigin(r, url); err != nil {
+			return nil, err
+		}
+	}
 	if err = h.checkConfig(r); err != nil {
 		return nil, err
 	}
-	return newRepository(h, r), nil
+	repo := newRepository(h, r)
+	if opts.NoCheckout {
+		if err = repo.(*repository).checkoutHead(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if mode == cloneModeWorktree {
+		if err = repo.(*repository).afterCheckout(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return repo, nil
 }
 
 func (h *cloner) Clone(ctx context.Context, url, dir string) (Repository, error) {
-	return h.CloneOnlyBranch(ctx, url, dir, "")
+	return h.invoke(ctx, "Clone", []interface{}{url, dir}, func(ctx context.Context, args []interface{}) (Repository, error) {
+		return h.cloneToDir(ctx, args[0].(string), args[1].(string), "", cloneModeWorktree)
+	})
 }
 
 func (h *cloner) CloneOnlyBranch(ctx context.Context, url, dir, branch string) (Repository, error) {
+	return h.invoke(ctx, "CloneOnlyBranch", []interface{}{url, dir, branch}, func(ctx context.Context, args []interface{}) (Repository, error) {
+		return h.cloneToDir(ctx, args[0].(string), args[1].(string), args[2].(string), cloneModeWorktree)
+	})
+}
+
+func (h *cloner) CloneBare(ctx context.Context, url, dir string) (Repository, error) {
+	return h.invoke(ctx, "CloneBare", []interface{}{url, dir}, func(ctx context.Context, args []interface{}) (Repository, error) {
+		return h.cloneToDir(ctx, args[0].(string), args[1].(string), "", cloneModeBare)
+	})
+}
+
+func (h *cloner) CloneMirror(ctx context.Context, url, dir string) (Repository, error) {
+	return h.invoke(ctx, "CloneMirror", []interface{}{url, dir}, func(ctx context.Context, args []interface{}) (Repository, error) {
+		return h.cloneToDir(ctx, args[0].(string), args[1].(string), "", cloneModeMirror)
+	})
+}
+
+func (h *cloner) cloneToDir(ctx context.Context, url, dir, branch string, mode cloneMode) (Repository, error) {
+	start := time.Now()
+	// 失败时删除由cloneToDir创建的目录，包括临时目录以及调用前不存在的目录
+	var created bool
 	if len(dir) == 0 {
 		var err error
 		if dir, err = ioutil.TempDir(dir, ""); err != nil {
 			return nil, err
 		}
+		created = true
+	} else if _, err := os.Stat(dir); os.IsNotExist(err) {
+		created = true
+	}
+	repo, err := h.clone(ctx, url, dir, branch, mode)
+	if err != nil && created {
+		_ = os.RemoveAll(dir)
 	}
-	repo, err := h.clone(ctx, url, dir, branch)
 	if repo != nil {
 		dir = repo.Root()
 	}
-	h.print(err, fmt.Sprintf("clone to dir, url: %s, dir: %s, branch: %s", url, dir, branch))
+	switch mode {
+	case cloneModeBare:
+		h.done(start, &err, "clone bare to dir", Field{FieldURL, redactURL(url)}, Field{"dir", dir})
+	case cloneModeMirror:
+		h.done(start, &err, "clone mirror to dir", Field{FieldURL, redactURL(url)}, Field{"dir", dir})
+	default:
+		h.done(start, &err, "clone to dir", Field{FieldURL, redactURL(url)}, Field{"dir", dir}, Field{"branch", branch})
+	}
 	return repo, err
 }
 
 func (h *cloner) CloneToMemory(ctx context.Context, url string) (Repository, error) {
-	return h.CloneOnlyBranchToMemory(ctx, url, "")
+	return h.invoke(ctx, "CloneToMemory", []interface{}{url}, func(ctx context.Context, args []interface{}) (Repository, error) {
+		return h.cloneToMemory(ctx, args[0].(string), "")
+	})
 }
 
 func (h *cloner) CloneOnlyBranchToMemory(ctx context.Context, url, branch string) (Repository, error) {
-	repo, err := h.clone(ctx, url, "", branch)
-	h.print(err, fmt.Sprintf("clone to memory, url: %s, branch: %s", url, branch))
+	return h.invoke(ctx, "CloneOnlyBranchToMemory", []interface{}{url, branch}, func(ctx context.Context, args []interface{}) (Repository, error) {
+		return h.cloneToMemory(ctx, args[0].(string), args[1].(string))
+	})
+}
+
+func (h *cloner) cloneToMemory(ctx context.Context, url, branch string) (Repository, error) {
+	start := time.Now()
+	repo, err := h.clone(ctx, url, "", branch, cloneModeWorktree)
+	h.done(start, &err, "clone to memory", Field{FieldURL, redactURL(url)}, Field{"branch", branch})
 	return repo, err
 }
 
-func (h *cloner) Open(_ context.Context, dir string) (Repository, error) {
+func (h *cloner) Open(ctx context.Context, dir string) (Repository, error) {
+	return h.invoke(ctx, "Open", []interface{}{dir}, func(ctx context.Context, args []interface{}) (Repository, error) {
+		return h.open(ctx, args[0].(string))
+	})
+}
+
+func (h *cloner) open(ctx context.Context, dir string) (Repository, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	var err error
 	var r *git.Repository
 	r, err = git.PlainOpen(dir)
 	if err != nil {
 		return nil, err
 	}
+	if r, err = h.openPromisor(r); err != nil {
+		return nil, err
+	}
 	if err = h.checkConfig(r); err != nil {
 		return nil, err
 	}
-	return newRepository(h, r), nil
+	repo := newRepository(h, r)
+	repo.(*repository).lockPath = lockFilePath(h, repo.(*repository))
+	return repo, nil
 }
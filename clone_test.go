@@ -0,0 +1,46 @@
+package gittools
+
+import (
+	"context"
+	. "github.com/smartystreets/goconvey/convey"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCloneCleanup(t *testing.T) {
+	Convey("remove dir created by clone on failure", t, func() {
+		ctx := context.Background()
+		g, upstream := newLocalRepository(t)
+		tmp := t.TempDir()
+		t.Setenv("TMPDIR", tmp)
+
+		Convey("clone failed", func() {
+			_, err := g.Clone(ctx, filepath.Join(tmp, "missing"), "")
+			So(err, ShouldNotBeNil)
+			entries, err := os.ReadDir(tmp)
+			So(err, ShouldBeNil)
+			So(entries, ShouldBeEmpty)
+		})
+
+		Convey("post clone step failed", func() {
+			p, err := NewLFSPointer(strings.NewReader("lfs"))
+			So(err, ShouldBeNil)
+			So(upstream.RewriteFile(ctx, ".gitattributes", []byte("*.bin filter=lfs diff=lfs merge=lfs -text\n")), ShouldBeNil)
+			So(upstream.RewriteFile(ctx, "data.bin", p.Bytes()), ShouldBeNil)
+			So(upstream.Commit(ctx, "lfs"), ShouldBeNil)
+			g.ApplyOption(WithLFS(true), WithLFSURL("http://127.0.0.1:1"))
+			dir := filepath.Join(tmp, "clone")
+			_, err = g.Clone(ctx, upstream.Root(), dir)
+			So(err, ShouldNotBeNil)
+			_, err = os.Stat(dir)
+			So(os.IsNotExist(err), ShouldBeTrue)
+			_, err = g.Clone(ctx, upstream.Root(), "")
+			So(err, ShouldNotBeNil)
+			entries, err := os.ReadDir(tmp)
+			So(err, ShouldBeNil)
+			So(entries, ShouldBeEmpty)
+		})
+	})
+}
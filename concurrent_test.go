@@ -0,0 +1,78 @@
+package gittools
+
+import (
+	"context"
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"sync"
+	"testing"
+)
+
+func TestConcurrent(t *testing.T) {
+	Convey("concurrent", t, func() {
+		ctx := context.Background()
+		const n = 8
+
+		Convey("default cloner", func() {
+			clones := make([]Cloner, n)
+			var wg sync.WaitGroup
+			for i := 0; i < n; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					clones[i] = Default()
+					_, _ = clones[i].(*cloner).auth()
+				}(i)
+			}
+			wg.Wait()
+			for i := 1; i < n; i++ {
+				So(clones[i], ShouldEqual, clones[0])
+			}
+		})
+
+		Convey("repository", func() {
+			g, upstream := newLocalRepository(t)
+			errs := make([]error, n)
+			var wg sync.WaitGroup
+			for i := 0; i < n; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					file := fmt.Sprintf("file%d.txt", i)
+					if errs[i] = upstream.RewriteFile(ctx, file, []byte(file)); errs[i] == nil {
+						errs[i] = upstream.Commit(ctx, file)
+					}
+					_, _ = upstream.IsClean()
+					_ = upstream.Root()
+				}(i)
+			}
+			wg.Wait()
+			for _, err := range errs {
+				So(err, ShouldBeNil)
+			}
+			clean, err := upstream.IsClean()
+			So(err, ShouldBeNil)
+			So(clean, ShouldBeTrue)
+			commit, err := upstream.(*repository).CommitObject(upstream.(*repository).headHash)
+			So(err, ShouldBeNil)
+			for i := 0; i < n; i++ {
+				_, err = commit.File(fmt.Sprintf("file%d.txt", i))
+				So(err, ShouldBeNil)
+			}
+
+			repos := make([]Repository, n)
+			for i := 0; i < n; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					repos[i], errs[i] = g.Clone(ctx, upstream.Root(), "")
+				}(i)
+			}
+			wg.Wait()
+			for i := 0; i < n; i++ {
+				So(errs[i], ShouldBeNil)
+				So(repos[i].RemoveAll(), ShouldBeNil)
+			}
+		})
+	})
+}
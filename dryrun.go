@@ -0,0 +1,88 @@
+package gittools
+
+import (
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"strings"
+)
+
+// dryRunRemoteRefs 根据本地的remote tracking ref以及标签推断远端的ref，dry run时不连接远端
+func (r *repository) dryRunRemoteRefs(remote string) ([]*plumbing.Reference, error) {
+	iter, err := r.References()
+	if err != nil {
+		return nil, err
+	}
+	prefix := plumbing.NewRemoteReferenceName(remote, "").String()
+	var refs []*plumbing.Reference
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference {
+			return nil
+		}
+		switch name := ref.Name(); {
+		case strings.HasPrefix(name.String(), prefix):
+			refs = append(refs, plumbing.NewHashReference(plumbing.NewBranchReferenceName(strings.TrimPrefix(name.String(), prefix)), ref.Hash()))
+		case name.IsTag():
+			refs = append(refs, ref)
+		}
+		return nil
+	})
+	return refs, err
+}
+
+// dryRunPush 计算push将要发送的refspec以及ref的更新并输出日志，不连接远端
+// 远端无法确认存在的ref在删除时仍会列出，Old为空
+func (r *repository) dryRunPush(o PushOptions) (updates []RefUpdate, err error) {
+	remote := getRemoteName(o.Remote)
+	if _, err = r.Repository.Remote(remote); err != nil {
+		return
+	}
+	var remoteRefs []*plumbing.Reference
+	if remoteRefs, err = r.dryRunRemoteRefs(remote); err != nil {
+		return
+	}
+	if updates, err = r.pushPlan(remote, remoteRefs, o); err != nil {
+		return
+	}
+	specs := o.refSpecs()
+	for _, rs := range specs {
+		if rs.IsDelete() && !hasRefUpdate(updates, rs.Dst("")) {
+			updates = append(updates, RefUpdate{Name: rs.Dst("").String(), Status: RefStatusDeleted})
+		}
+	}
+	r.h.emit(LevelInfo, "dry run", Field{FieldOp, "push"}, Field{"remote", remote}, Field{"refspecs", specs}, Field{"updates", updates})
+	return
+}
+
+func hasRefUpdate(updates []RefUpdate, name plumbing.ReferenceName) bool {
+	for _, u := range updates {
+		if u.Name == name.String() {
+			return true
+		}
+	}
+	return false
+}
+
+func refSpecStrings(specs []config.RefSpec) []string {
+	ss := make([]string, 0, len(specs))
+	for _, rs := range specs {
+		ss = append(ss, rs.String())
+	}
+	return ss
+}
+
+// dryRunMirrorSync 输出MirrorSync将要fetch以及push的refspec，不fetch也不push
+// 不连接远端，因此无法列出镜像推送时将要删除的远端ref
+func (r *repository) dryRunMirrorSync() error {
+	if _, err := r.Repository.Remote(DefaultRemoteName); err != nil {
+		return err
+	}
+	specs := []config.RefSpec{mirrorRefSpec}
+	r.h.emit(LevelInfo, "dry run", Field{FieldOp, "mirror fetch"}, Field{"remote", DefaultRemoteName}, Field{"refspecs", specs}, Field{"prune", true})
+	if _, err := r.Repository.Remote(MirrorRemoteName); err == ErrRemoteNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	r.h.emit(LevelInfo, "dry run", Field{FieldOp, "mirror push"}, Field{"remote", MirrorRemoteName}, Field{"refspecs", specs})
+	return nil
+}
@@ -0,0 +1,81 @@
+package gittools
+
+import (
+	"context"
+	"fmt"
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	Convey("dry run", t, func() {
+		ctx := context.Background()
+		remote := newBareRemote(t)
+		_, r := newLocalRepository(t)
+		So(r.AddRemote(ctx, DefaultRemoteName, remote), ShouldBeNil)
+		_, err := r.Push(ctx, "")
+		So(err, ShouldBeNil)
+		v1, err := r.CreateTag(ctx, "v1", "v1", "")
+		So(err, ShouldBeNil)
+		So(v1.Push(ctx), ShouldBeNil)
+
+		var logs []map[string]interface{}
+		g := New(WithUserName("botman"), WithUserEmail("botman@sandwich.com"), WithDryRun(true),
+			WithStructuredLogger(StructuredLoggerFunc(func(level Level, msg string, fields ...Field) {
+				if msg != "dry run" {
+					return
+				}
+				m := make(map[string]interface{})
+				for _, f := range fields {
+					m[f.Key] = fmt.Sprint(f.Value)
+				}
+				logs = append(logs, m)
+			})))
+		dr, err := g.Open(ctx, r.Root())
+		So(err, ShouldBeNil)
+		// dry run不连接远端
+		So(dr.SetRemoteURL(ctx, DefaultRemoteName, "https://127.0.0.1:1/none.git"), ShouldBeNil)
+		remoteHead := func() string {
+			repo, err0 := git.PlainOpen(remote)
+			So(err0, ShouldBeNil)
+			ref, err0 := repo.Reference(plumbing.Master, true)
+			So(err0, ShouldBeNil)
+			return ref.Hash().String()
+		}
+		old := remoteHead()
+
+		So(dr.RewriteFile(ctx, "a.txt", []byte("a")), ShouldBeNil)
+		So(dr.Commit(ctx, "a"), ShouldBeNil)
+		sr, err := dr.Push(ctx, "")
+		So(err, ShouldBeNil)
+		So(sr.IsUpdated(), ShouldBeTrue)
+		So(sr.Old, ShouldEqual, old)
+		So(sr.New, ShouldEqual, dr.(*repository).headHash.String())
+		So(remoteHead(), ShouldEqual, old)
+
+		So(dr.DeleteTag(ctx, "v1"), ShouldBeNil)
+		So(dr.DeleteBranch(ctx, "master"), ShouldBeNil)
+		_, err = dr.(*repository).Storer.Reference(plumbing.NewTagReferenceName("v1"))
+		So(err, ShouldBeNil)
+		_, err = dr.(*repository).Storer.Reference(plumbing.Master)
+		So(err, ShouldBeNil)
+
+		tg, err := dr.Tag(ctx, "v1")
+		So(err, ShouldBeNil)
+		So(tg.Delete(ctx), ShouldBeNil)
+		So(tg.Push(ctx), ShouldBeNil)
+		_, err = dr.(*repository).Storer.Reference(plumbing.NewTagReferenceName("v1"))
+		So(err, ShouldBeNil)
+
+		So(logs, ShouldHaveLength, 4)
+		So(logs[0]["refspecs"], ShouldEqual, "["+config.DefaultPushRefSpec+"]")
+		So(logs[1]["refspecs"], ShouldEqual, "[:refs/tags/v1]")
+		So(logs[1]["updates"], ShouldEqual, fmt.Sprintf("[deleted refs/tags/v1 %s..0000000]", v1.(*tag).Hash().String()[:7]))
+		So(logs[2]["refspecs"], ShouldEqual, "[:refs/heads/master]")
+		So(logs[2]["updates"], ShouldEqual, fmt.Sprintf("[deleted refs/heads/master %s..0000000]", old[:7]))
+		So(logs[3]["refspecs"], ShouldEqual, "[:refs/tags/v1]")
+	})
+}
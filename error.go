@@ -1,8 +1,16 @@
 package gittools
 
 import (
+	"context"
+	"errors"
 	git "github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"net"
+	"net/http"
+	"strings"
 )
 
 var (
@@ -36,9 +44,162 @@ var (
 	ErrReferenceNotFound         = plumbing.ErrReferenceNotFound
 )
 
+var (
+	// ErrDirtyWorktree 工作区存在未提交的修改，如Checkout、Pull前工作区不干净
+	ErrDirtyWorktree = errors.New("current worktree not clean")
+	// ErrAuthKeyNotFound 未找到RsaPath指定的ssh私钥
+	ErrAuthKeyNotFound = errors.New("not found rsa path")
+)
+
+// OpError Cloner以及Repository的操作失败时返回的错误，可通过errors.Is、errors.As判断原始错误
+type OpError struct {
+	// Op 操作名称，与日志中的op一致
+	Op string
+	// Root 仓库的根目录，内存中的仓库为空
+	Root string
+	// URL 远端仓库地址，不包括凭证
+	URL string
+	// Ref 操作时Repository当前的ref，或者Pool.Acquire的ref
+	Ref string
+	// Err 原始错误
+	Err error
+}
+
+func (e *OpError) Error() string {
+	var sb strings.Builder
+	sb.WriteString(e.Op)
+	for _, f := range []Field{{"root", e.Root}, {FieldURL, e.URL}, {FieldRef, e.Ref}} {
+		if v := f.Value.(string); len(v) > 0 {
+			sb.WriteString(" " + f.Key + "=" + logfmtValue(v))
+		}
+	}
+	sb.WriteString(": " + e.Err.Error())
+	return sb.String()
+}
+
+func (e *OpError) Unwrap() error { return e.Err }
+
+// wrapOpError 将err包装为*OpError，err已经是*OpError时保留内层的操作，仅补充其缺少的根目录、远端地址以及ref
+func wrapOpError(err error, op, root, url, ref string) error {
+	if err == nil {
+		return nil
+	}
+	var oe *OpError
+	if !errors.As(err, &oe) {
+		return &OpError{Op: op, Root: root, URL: url, Ref: ref, Err: err}
+	}
+	for _, f := range [][2]*string{{&oe.Root, &root}, {&oe.URL, &url}, {&oe.Ref, &ref}} {
+		if len(*f[0]) == 0 {
+			*f[0] = *f[1]
+		}
+	}
+	return err
+}
+
+// checkErr 仅忽略NoErrAlreadyUpToDate，其他错误(如ErrNonFastForwardUpdate)均需返回给调用方
 func checkErr(err error) error {
-	if err == NoErrAlreadyUpToDate || err == ErrNonFastForwardUpdate {
+	if err == NoErrAlreadyUpToDate {
 		err = nil
 	}
 	return err
 }
+
+// authMessages 无法通过类型判断时，通过错误信息识别的认证错误，如ssh握手失败
+var authMessages = []string{
+	"unable to authenticate",
+	"no supported methods remain",
+	"permission denied (publickey",
+	"host key mismatch",
+	"key is unknown",
+}
+
+// IsAuthError 错误是否是认证或者授权失败，如凭证错误、ssh私钥不存在、ssh握手认证失败以及HTTP 401、403，需要人工处理
+func IsAuthError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, transport.ErrAuthenticationRequired) || errors.Is(err, transport.ErrAuthorizationFailed) ||
+		errors.Is(err, ErrAuthKeyNotFound) {
+		return true
+	}
+	var keyErr *knownhosts.KeyError
+	var revokedErr *knownhosts.RevokedError
+	var passErr *ssh.PassphraseMissingError
+	if errors.As(err, &keyErr) || errors.As(err, &revokedErr) || errors.As(err, &passErr) {
+		return true
+	}
+	if status := httpStatus(err); status == http.StatusUnauthorized || status == http.StatusForbidden {
+		return true
+	}
+	return containsAny(err, authMessages)
+}
+
+// IsNetworkError 错误是否是网络错误，包括连接被重置、HTTP 429以及5xx等临时性错误、DNS解析失败以及非认证原因的ssh握手失败
+func IsNetworkError(err error) bool {
+	if err == nil || IsAuthError(err) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if isTransientError(err) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return containsAny(err, []string{"handshake failed", "no such host"})
+}
+
+// IsNotFound 错误是否是仓库、remote、分支、标签、引用或者对象不存在，包括HTTP 404
+func IsNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, target := range []error{
+		transport.ErrRepositoryNotFound, ErrRepositoryNotExists, ErrRemoteNotFound, ErrReferenceNotFound,
+		ErrBranchNotFound, ErrTagNotFound, ErrObjectNotFound, ErrSubmoduleNotFound, ErrLFSEndpointNotFound,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return httpStatus(err) == http.StatusNotFound
+}
+
+// IsConflict 错误是否是与远端或者本地状态冲突，如non-fast-forward、分支或者标签已存在、工作区不干净，包括HTTP 409
+func IsConflict(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, target := range []error{
+		ErrNonFastForwardUpdate, ErrForceNeeded, ErrBranchExists, ErrTagExists, ErrRemoteExists,
+		ErrRepositoryAlreadyExists, ErrDirtyWorktree, ErrWorktreeNotClean, ErrUnstagedChanges,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	if httpStatus(err) == http.StatusConflict {
+		return true
+	}
+	// 远端拒绝push时返回的错误，如failed to update ref "refs/heads/master": non-fast-forward
+	return containsAny(err, []string{"non-fast-forward", "fetch first"})
+}
+
+// IsRetryable 重新执行整个操作是否可能成功，包括临时性的网络错误、操作超时以及等待文件锁超时
+// 与RetryPolicy默认的判断不同，操作超时(如FetchTimeout)也视为可重试，调用方应使用新的ctx重试
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	return isTransientError(err) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrLockTimeout)
+}
+
+func containsAny(err error, messages []string) bool {
+	msg := strings.ToLower(err.Error())
+	for _, m := range messages {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package gittools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	. "github.com/smartystreets/goconvey/convey"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+)
+
+func TestOpError(t *testing.T) {
+	Convey("op error", t, func() {
+		ctx := context.Background()
+		Convey("repository", func() {
+			_, r := newLocalRepository(t)
+			err := r.DeleteLocalBranch(ctx, "none")
+			var oe *OpError
+			So(errors.As(err, &oe), ShouldBeTrue)
+			So(oe.Op, ShouldEqual, "delete local branch")
+			So(oe.Root, ShouldEqual, r.Root())
+			So(oe.Ref, ShouldEqual, "refs/heads/master")
+			So(errors.Is(err, ErrBranchNotFound), ShouldBeTrue)
+			So(err.Error(), ShouldEqual, "delete local branch root="+r.Root()+" ref=refs/heads/master: "+ErrBranchNotFound.Error())
+		})
+
+		Convey("dirty worktree", func() {
+			_, r := newLocalRepository(t)
+			So(r.RewriteFile(ctx, "dirty.txt", []byte("dirty")), ShouldBeNil)
+			err := r.CheckoutBranch(ctx, "master", "")
+			So(errors.Is(err, ErrDirtyWorktree), ShouldBeTrue)
+			var oe *OpError
+			So(errors.As(err, &oe), ShouldBeTrue)
+			So(oe.Op, ShouldEqual, "checkout")
+		})
+
+		Convey("auth key not found", func() {
+			g := New(WithRsaPath("/not/exists/id_rsa"))
+			_, err := g.CloneToMemory(ctx, "ssh://git@127.0.0.1/none.git")
+			So(errors.Is(err, ErrAuthKeyNotFound), ShouldBeTrue)
+			var oe *OpError
+			So(errors.As(err, &oe), ShouldBeTrue)
+			So(oe.Op, ShouldEqual, "auth")
+			So(oe.URL, ShouldEqual, "ssh://git@127.0.0.1/none.git")
+		})
+
+	})
+}
+
+func TestClassifyError(t *testing.T) {
+	Convey("classify error", t, func() {
+		wrap := func(err error) error { return &OpError{Op: "push", Err: fmt.Errorf("remote: %w", err)} }
+		Convey("IsAuthError", func() {
+			So(IsAuthError(wrap(transport.ErrAuthenticationRequired)), ShouldBeTrue)
+			So(IsAuthError(wrap(ErrAuthKeyNotFound)), ShouldBeTrue)
+			So(IsAuthError(errors.New("ssh: handshake failed: ssh: unable to authenticate, attempted methods [none publickey]")), ShouldBeTrue)
+			So(IsAuthError(&lfsHTTPError{StatusCode: http.StatusForbidden}), ShouldBeTrue)
+			So(IsAuthError(wrap(transport.ErrRepositoryNotFound)), ShouldBeFalse)
+		})
+
+		Convey("IsNetworkError", func() {
+			So(IsNetworkError(errors.New("ssh: handshake failed: ssh: unable to authenticate")), ShouldBeFalse)
+			So(IsNetworkError(errors.New("ssh: handshake failed: EOF")), ShouldBeTrue)
+			So(IsNetworkError(wrap(&net.DNSError{Err: "no such host", Name: "github.com"})), ShouldBeTrue)
+			So(IsNetworkError(wrap(syscall.ECONNRESET)), ShouldBeTrue)
+		})
+
+		Convey("IsNotFound", func() {
+			So(IsNotFound(wrap(transport.ErrRepositoryNotFound)), ShouldBeTrue)
+			So(IsNotFound(&lfsHTTPError{StatusCode: http.StatusNotFound}), ShouldBeTrue)
+			So(IsNotFound(wrap(ErrDirtyWorktree)), ShouldBeFalse)
+		})
+
+		Convey("IsConflict", func() {
+			So(IsConflict(wrap(ErrNonFastForwardUpdate)), ShouldBeTrue)
+			So(IsConflict(errors.New(`failed to update ref "refs/heads/master": non-fast-forward`)), ShouldBeTrue)
+			So(IsConflict(wrap(ErrDirtyWorktree)), ShouldBeTrue)
+			So(IsConflict(wrap(transport.ErrRepositoryNotFound)), ShouldBeFalse)
+		})
+
+		Convey("IsRetryable", func() {
+			So(IsRetryable(wrap(syscall.ECONNRESET)), ShouldBeTrue)
+			So(IsRetryable(wrap(context.DeadlineExceeded)), ShouldBeTrue)
+			So(IsRetryable(wrap(ErrLockTimeout)), ShouldBeTrue)
+			So(IsRetryable(fmt.Errorf("sync: %w", wrap(syscall.ECONNRESET))), ShouldBeTrue)
+			So(IsRetryable(wrap(context.Canceled)), ShouldBeFalse)
+			So(IsRetryable(wrap(transport.ErrAuthenticationRequired)), ShouldBeFalse)
+		})
+
+		Convey("others", func() {
+			for _, f := range []func(error) bool{IsAuthError, IsNetworkError, IsNotFound, IsConflict, IsRetryable} {
+				So(f(nil), ShouldBeFalse)
+				So(f(errors.New("something else")), ShouldBeFalse)
+			}
+		})
+	})
+}
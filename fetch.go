@@ -0,0 +1,178 @@
+package gittools
+
+import (
+	"context"
+	"fmt"
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"time"
+)
+
+// TagMode fetch时标签的跟随模式
+type TagMode = git.TagMode
+
+const (
+	// TagFollowing 仅fetch指向已fetch对象的标签，默认模式
+	TagFollowing = git.TagFollowing
+	// AllTags fetch所有标签
+	AllTags = git.AllTags
+	// NoTags 不fetch标签
+	NoTags = git.NoTags
+)
+
+// unshallowDepth 与git fetch --unshallow一致，使用最大深度
+const unshallowDepth = 0x7fffffff
+
+// FetchOptions FetchWithOptions 的参数
+type FetchOptions struct {
+	// Remote remote名称，为空则为origin
+	Remote string
+	// Branches 仅fetch指定的分支，Branches、Tags以及RefSpecs均为空则使用remote配置的refspec
+	Branches []string
+	// Tags 仅fetch指定的标签
+	Tags []string
+	// RefSpecs 额外fetch的refspec，如 +refs/heads/a:refs/remotes/origin/a
+	RefSpecs []string
+	// Prune 删除远端已不存在的remote tracking分支
+	Prune bool
+	// TagMode 标签跟随模式，默认为TagFollowing
+	TagMode TagMode
+	// Depth 限制fetch的深度，为0则使用配置的Depth
+	Depth int
+	// Deepen 在当前shallow深度的基础上加深N个commit，设置后忽略Depth
+	Deepen int
+	// Unshallow 获取完整历史，将shallow clone转换为完整clone，设置后忽略Depth和Deepen
+	Unshallow bool
+}
+
+func (o FetchOptions) refSpecs(remote string) []config.RefSpec {
+	var specs []config.RefSpec
+	for _, b := range o.Branches {
+		brn := getBranchReferenceName(b)
+		specs = append(specs, config.RefSpec(fmt.Sprintf("+%s:%s", brn, getBranchRemoteReferenceName(remote, brn.Short()))))
+	}
+	for _, t := range o.Tags {
+		trn := getTagReferenceName(t)
+		specs = append(specs, config.RefSpec(fmt.Sprintf("+%s:%s", trn, trn)))
+	}
+	for _, v := range o.RefSpecs {
+		specs = append(specs, config.RefSpec(v))
+	}
+	return specs
+}
+
+// shallowDepth 当前分支从HEAD沿first parent到shallow边界的commit数量，非shallow仓库返回0
+func (r *repository) shallowDepth() (int, error) {
+	shallows, err := r.Storer.Shallow()
+	if err != nil || len(shallows) == 0 {
+		return 0, err
+	}
+	boundary := make(map[plumbing.Hash]struct{}, len(shallows))
+	for _, h := range shallows {
+		boundary[h] = struct{}{}
+	}
+	var head *plumbing.Reference
+	if head, err = r.Head(); err != nil {
+		return 0, err
+	}
+	var c *object.Commit
+	depth := 0
+	for hash := head.Hash(); ; hash = c.ParentHashes[0] {
+		if c, err = r.CommitObject(hash); err != nil {
+			return 0, err
+		}
+		depth++
+		if _, ok := boundary[hash]; ok || len(c.ParentHashes) == 0 {
+			return depth, nil
+		}
+	}
+}
+
+// pruneShallow 移除父commit已全部存在的shallow记录，go-git在加深历史后不会自动移除
+func (r *repository) pruneShallow() error {
+	shallows, err := r.Storer.Shallow()
+	if err != nil || len(shallows) == 0 {
+		return err
+	}
+	var remain []plumbing.Hash
+	for _, h := range shallows {
+		c, err0 := r.CommitObject(h)
+		if err0 != nil {
+			remain = append(remain, h)
+			continue
+		}
+		for _, p := range c.ParentHashes {
+			if _, err0 = r.Storer.EncodedObject(plumbing.CommitObject, p); err0 != nil {
+				remain = append(remain, h)
+				break
+			}
+		}
+	}
+	if len(remain) == len(shallows) {
+		return nil
+	}
+	return r.Storer.SetShallow(remain)
+}
+
+func (r *repository) FetchWithOptions(ctx context.Context, o FetchOptions) (sr *SyncResult, err error) {
+	defer r.lock()()
+	defer func(start time.Time) {
+		r.done(start, &err, "fetch with options", Field{"remote", getRemoteName(o.Remote)}, Field{"branches", o.Branches}, Field{"tags", o.Tags}, Field{"refspecs", o.RefSpecs})
+	}(time.Now())
+	return r.fetchWithOptions(ctx, o)
+}
+
+func (r *repository) fetchWithOptions(ctx context.Context, o FetchOptions) (sr *SyncResult, err error) {
+	defer r.acquire(ctx, &err)()
+	if err != nil {
+		return
+	}
+	ctx, cancel := withTimeout(ctx, r.h.GetFetchTimeout())
+	defer cancel()
+	remote := getRemoteName(o.Remote)
+	var auth transport.AuthMethod
+	if auth, err = r.remoteAuth(remote); err != nil {
+		return
+	}
+	depth := o.Depth
+	if depth == 0 {
+		depth = r.h.GetDepth()
+	}
+	switch {
+	case o.Unshallow:
+		depth = unshallowDepth
+	case o.Deepen > 0:
+		var current int
+		if current, err = r.shallowDepth(); err != nil {
+			return
+		}
+		depth = current + o.Deepen
+	}
+	var before, after map[plumbing.ReferenceName]plumbing.Hash
+	if before, err = r.snapshotRefs(getRemoteRefPrefix(remote), tagRefPrefix); err != nil {
+		return
+	}
+	err = checkErr(r.h.retry(ctx, "fetch", func() error {
+		return r.Repository.FetchContext(r.h.metered(ctx, "fetch"), &git.FetchOptions{
+			RemoteName: remote,
+			RefSpecs:   o.refSpecs(remote),
+			Auth:       auth,
+			Progress:   r.h.progress(ctx, "fetch"),
+			Depth:      depth,
+			Tags:       o.TagMode,
+			Prune:      o.Prune,
+		})
+	}))
+	if err == nil && (o.Unshallow || o.Deepen > 0) {
+		err = r.pruneShallow()
+	}
+	if err == nil {
+		if after, err = r.snapshotRefs(getRemoteRefPrefix(remote), tagRefPrefix); err == nil {
+			sr = newSyncResult(getBranchRemoteReferenceName(remote, r.currentRefName.Short()), r.diffRefs(before, after))
+		}
+	}
+	return
+}
@@ -0,0 +1,56 @@
+package gittools
+
+import (
+	"context"
+	"github.com/go-git/go-git/v5/plumbing"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestFetchWithOptions(t *testing.T) {
+	Convey("fetch with options", t, func() {
+		ctx := context.Background()
+		g, upstream := newLocalRepository(t)
+		for _, v := range []string{"a", "b", "c"} {
+			So(upstream.RewriteFile(ctx, v+".txt", []byte(v)), ShouldBeNil)
+			So(upstream.Commit(ctx, v), ShouldBeNil)
+		}
+		r, err := g.Clone(ctx, upstream.Root(), "")
+		So(err, ShouldBeNil)
+		defer func() { _ = r.RemoveAll() }()
+		_, err = upstream.CreateBranch(ctx, "feature", "")
+		So(err, ShouldBeNil)
+		_, err = upstream.CreateTag(ctx, "v0.0.1", "release", "")
+		So(err, ShouldBeNil)
+		repo := r.(*repository)
+		depth, err := repo.shallowDepth()
+		So(err, ShouldBeNil)
+		So(depth, ShouldEqual, 1)
+
+		sr, err := r.FetchWithOptions(ctx, FetchOptions{Branches: []string{"feature"}, TagMode: NoTags})
+		So(err, ShouldBeNil)
+		So(sr.Refs, ShouldHaveLength, 1)
+		So(sr.Refs[0].Name, ShouldEqual, "refs/remotes/origin/feature")
+		So(sr.Refs[0].Status, ShouldEqual, RefStatusCreated)
+
+		_, err = r.FetchWithOptions(ctx, FetchOptions{Deepen: 1})
+		So(err, ShouldBeNil)
+		depth, err = repo.shallowDepth()
+		So(err, ShouldBeNil)
+		So(depth, ShouldEqual, 2)
+
+		_, err = r.FetchWithOptions(ctx, FetchOptions{Unshallow: true, TagMode: AllTags})
+		So(err, ShouldBeNil)
+		shallows, err := repo.Storer.Shallow()
+		So(err, ShouldBeNil)
+		So(shallows, ShouldBeEmpty)
+		_, err = repo.Reference(plumbing.NewTagReferenceName("v0.0.1"), false)
+		So(err, ShouldBeNil)
+
+		So(upstream.DeleteLocalBranch(ctx, "feature"), ShouldBeNil)
+		sr, err = r.FetchWithOptions(ctx, FetchOptions{Prune: true})
+		So(err, ShouldBeNil)
+		So(sr.Refs, ShouldHaveLength, 1)
+		So(sr.Refs[0].Status, ShouldEqual, RefStatusDeleted)
+	})
+}
@@ -0,0 +1,157 @@
+package gittools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-git/go-billy/v5"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// lockFileName 文件锁位于.git目录下，bare仓库则位于根目录下
+const lockFileName = "gittools.lock"
+
+// lockRetryInterval 等待文件锁时的重试间隔
+const lockRetryInterval = 50 * time.Millisecond
+
+// ErrLockTimeout 等待其他进程释放文件锁超时
+var ErrLockTimeout = errors.New("repository lock timeout")
+
+// lockInfo 文件锁的内容，用于判断持有锁的进程是否已退出
+type lockInfo struct {
+	PID  int       `json:"pid"`
+	Host string    `json:"host"`
+	Time time.Time `json:"time"`
+}
+
+// lockFilePath 开启FileLock时文件锁的路径，内存中的Repository返回空
+func lockFilePath(h *cloner, r *repository) string {
+	if !h.GetFileLock() {
+		return ""
+	}
+	if fs, ok := r.Storer.(interface{ Filesystem() billy.Filesystem }); ok {
+		return filepath.Join(fs.Filesystem().Root(), lockFileName)
+	}
+	return ""
+}
+
+// isStale 持有锁的进程已退出，或者锁的时间超过了LockStaleTimeout
+func (h *cloner) isStale(path string) bool {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	staleTimeout := h.GetLockStaleTimeout()
+	var info lockInfo
+	data, err := ioutil.ReadFile(path)
+	if err != nil || json.Unmarshal(data, &info) != nil {
+		// 无法解析时以文件的修改时间为准
+		return staleTimeout > 0 && time.Since(fi.ModTime()) > staleTimeout
+	}
+	if staleTimeout > 0 && time.Since(info.Time) > staleTimeout {
+		return true
+	}
+	host, _ := os.Hostname()
+	return info.Host == host && info.PID != os.Getpid() && !processAlive(info.PID)
+}
+
+// tryLock 尝试创建文件锁，已被其他进程持有时返回false
+func tryLock(path string) (bool, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	host, _ := os.Hostname()
+	err = json.NewEncoder(f).Encode(lockInfo{PID: os.Getpid(), Host: host, Time: time.Now()})
+	if err0 := f.Close(); err == nil {
+		err = err0
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return false, err
+	}
+	return true, nil
+}
+
+// lockFile 获取文件锁并返回释放函数，用于协调多个进程对同一工作区的修改，未开启FileLock时直接返回
+// 锁已被持有时每隔lockRetryInterval重试，直至LockTimeout超时，过期的锁会被移除
+// 修改操作均在开始时调用lockFile，ctx已取消时直接返回错误，partial clone在操作期间按需获取缺失的对象时也使用该ctx
+func (r *repository) lockFile(ctx context.Context) (func(), error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	unlock, err := r.waitFileLock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	restore := r.bind(ctx)
+	return func() { restore(); unlock() }, nil
+}
+
+// acquire 获取文件锁，结果赋值给err，返回的释放函数需要defer调用，获取失败时返回空函数
+//
+//	defer r.acquire(ctx, &err)()
+//	if err != nil {
+//		return
+//	}
+func (r *repository) acquire(ctx context.Context, err *error) func() {
+	var unlock func()
+	if unlock, *err = r.lockFile(ctx); *err != nil {
+		return func() {}
+	}
+	return unlock
+}
+
+// waitFileLock 等待并获取Repository的文件锁
+func (r *repository) waitFileLock(ctx context.Context) (func(), error) {
+	if len(r.lockPath) == 0 {
+		return func() {}, nil
+	}
+	return r.h.waitFileLock(ctx, r.lockPath)
+}
+
+// waitFileLock 等待并获取path的文件锁
+func (h *cloner) waitFileLock(ctx context.Context, path string) (func(), error) {
+	deadline := time.Now().Add(h.GetLockTimeout())
+	for {
+		ok, err := tryLock(path)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return func() { _ = os.Remove(path) }, nil
+		}
+		if h.isStale(path) {
+			h.removeStale(path)
+			continue
+		}
+		if !time.Now().Before(deadline) {
+			return nil, fmt.Errorf("%w: %s", ErrLockTimeout, path)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
+
+// removeStale 移除过期的锁，先重命名再删除，避免多个进程同时删除时误删新的锁
+// 判断过期后锁可能已被其他进程移除并重新获取，重命名后需再次确认，未过期则还原
+func (h *cloner) removeStale(path string) {
+	stale := fmt.Sprintf("%s.%d.stale", path, os.Getpid())
+	if os.Rename(path, stale) != nil {
+		return
+	}
+	if !h.isStale(stale) {
+		// 使用Link还原，不会覆盖期间新创建的锁
+		_ = os.Link(stale, path)
+	}
+	_ = os.Remove(stale)
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package gittools
+
+import (
+	"syscall"
+)
+
+// processAlive pid对应的进程是否存在
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
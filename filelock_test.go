@@ -0,0 +1,71 @@
+package gittools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileLock(t *testing.T) {
+	Convey("file lock", t, func() {
+		ctx := context.Background()
+		g, upstream := newLocalRepository(t, WithFileLock(true), WithLockTimeout(100*time.Millisecond))
+		r, err := g.Open(ctx, upstream.Root())
+		So(err, ShouldBeNil)
+		lockPath := filepath.Join(upstream.Root(), ".git", lockFileName)
+		writeLock := func(pid int, at time.Time) {
+			host, _ := os.Hostname()
+			data, _ := json.Marshal(lockInfo{PID: pid, Host: host, Time: at})
+			So(ioutil.WriteFile(lockPath, data, 0644), ShouldBeNil)
+		}
+
+		Convey("released after operation", func() {
+			So(r.RewriteFile(ctx, "a.txt", []byte("a")), ShouldBeNil)
+			_, err := os.Stat(lockPath)
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+
+		Convey("wait timeout", func() {
+			writeLock(os.Getpid(), time.Now())
+			err := r.RewriteFile(ctx, "a.txt", []byte("a"))
+			So(errors.Is(err, ErrLockTimeout), ShouldBeTrue)
+			So(os.Remove(lockPath), ShouldBeNil)
+		})
+
+		Convey("stale lock", func() {
+			cmd := exec.Command("true")
+			So(cmd.Run(), ShouldBeNil)
+			writeLock(cmd.Process.Pid, time.Now())
+			So(r.RewriteFile(ctx, "a.txt", []byte("a")), ShouldBeNil)
+
+			old := g.ApplyOption(WithLockStaleTimeout(time.Minute))
+			defer g.ApplyOption(old...)
+			writeLock(os.Getpid(), time.Now().Add(-time.Hour))
+			So(r.RewriteFile(ctx, "b.txt", []byte("b")), ShouldBeNil)
+			_, err := os.Stat(lockPath)
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+
+		Convey("lock reacquired before removal", func() {
+			// 判断过期后锁被其他进程重新获取
+			writeLock(os.Getpid(), time.Now())
+			data, err := ioutil.ReadFile(lockPath)
+			So(err, ShouldBeNil)
+			r.(*repository).h.removeStale(lockPath)
+			got, err := ioutil.ReadFile(lockPath)
+			So(err, ShouldBeNil)
+			So(got, ShouldResemble, data)
+			matches, err := filepath.Glob(lockPath + ".*")
+			So(err, ShouldBeNil)
+			So(matches, ShouldBeEmpty)
+			So(os.Remove(lockPath), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,15 @@
+package gittools
+
+import (
+	"os"
+)
+
+// processAlive pid对应的进程是否存在，windows下进程不存在时FindProcess返回错误
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	_ = p.Release()
+	return true
+}
@@ -1,23 +1,50 @@
 package gittools
 
 import (
-	"io"
 	"log"
 	"os"
+	"time"
 )
 
 type Logger interface {
 	Println(v ...interface{})
-	Writer() io.Writer
 }
 
 //go:generate optiongen --option_with_struct_name=false --new_func=NewConfig --xconf=true --empty_composite_nil=true --usage_tag_name=usage
 func ConfigOptionDeclareWithDefault() interface{} {
 	return map[string]interface{}{
-		"RsaPath":   ".ssh/id_rsa",                                 // @MethodComment(rsa 绝对路径或者home目录下相对路径)
-		"Logger":    Logger(log.New(os.Stdout, "", log.LstdFlags)), // @MethodComment(日志输出)
-		"UserName":  "",                                            // @MethodComment(config user.name)
-		"UserEmail": "",                                            // @MethodComment(config user.email)
-		"Depth":     1,                                             // @MethodComment(git depth)
+		"RsaPath":           ".ssh/id_rsa",                                 // @MethodComment(rsa 绝对路径或者home目录下相对路径)
+		"Logger":            Logger(log.New(os.Stdout, "", log.LstdFlags)), // @MethodComment(日志输出，为nil则不输出)
+		"UserName":          "",                                            // @MethodComment(config user.name)
+		"UserEmail":         "",                                            // @MethodComment(config user.email)
+		"Depth":             1,                                             // @MethodComment(git depth)
+		"Signer":            Signer(nil),                                   // @MethodComment(commit和annotated tag的签名器，为nil则不签名，可通过NewOpenPGPSigner或NewSSHSigner创建)
+		"VerifyKeyRing":     "",                                            // @MethodComment(Verify时使用的OpenPGP armored公钥环)
+		"AllowedSigners":    []string(nil),                                 // @MethodComment(Verify时允许的SSH签名公钥，authorized_keys格式)
+		"CommitTemplate":    "",                                            // @MethodComment(commit message模板，text/template格式，可使用CommitTemplateData中的字段，为空则直接使用comment)
+		"SignOff":           false,                                         // @MethodComment(Commit时是否追加Signed-off-by trailer)
+		"ChangeID":          false,                                         // @MethodComment(Commit时是否追加Change-Id trailer)
+		"CoAuthors":         []string(nil),                                 // @MethodComment(Commit时追加的Co-authored-by trailer，格式为name <email>)
+		"Trailers":          []Trailer(nil),                                // @MethodComment(Commit时追加的自定义trailer)
+		"SparsePaths":       []string(nil),                                 // @MethodComment(sparse checkout的目录，Clone时仅checkout这些目录并保存到仓库中，为空则checkout所有文件，Open时优先使用仓库中保存的目录)
+		"Filter":            "",                                            // @MethodComment(partial clone的filter，如blob:none、blob:limit=<n>、tree:0，为空则完整clone，缺失的对象在访问时按需获取)
+		"RecurseSubmodules": false,                                         // @MethodComment(Clone、CheckoutBranch、CheckoutTag以及Pull时是否初始化并递归更新submodule)
+		"LFS":               false,                                         // @MethodComment(Clone、CheckoutBranch、CheckoutTag以及Pull后是否自动下载LFS对象并替换工作区中的pointer文件，以及Add、AddAll、RewriteFile时是否将被LFS管理的文件替换为pointer、Push时是否上传LFS对象，私有LFS服务仅支持通过LFSURL或者https remote地址中的userinfo认证，不支持ssh remote的git-lfs-authenticate)
+		"LFSURL":            "",                                            // @MethodComment(LFS服务地址，为空则依次使用git config中的lfs.url、.lfsconfig以及origin的url推导，地址中的userinfo作为HTTP basic认证的凭证)
+		"CacheDir":          "",                                            // @MethodComment(clone缓存目录，不为空时每个url在该目录中保存一份bare mirror，clone前fetch更新，并从本地mirror clone后将origin指回原url，多个进程可共享同一目录，更新mirror时通过文件锁串行，等待时间受LockTimeout限制)
+		"FileLock":          false,                                         // @MethodComment(Open的Repository在修改操作时是否获取.git/gittools.lock文件锁，用于协调多个进程对同一工作区的操作)
+		"LockTimeout":       time.Duration(time.Minute),                    // @MethodComment(等待文件锁的超时时间)
+		"LockStaleTimeout":  time.Duration(0),                              // @MethodComment(文件锁超过该时间则视为过期并移除，为0则仅在持有锁的进程已退出时移除)
+		"RetryPolicy":       (*RetryPolicy)(nil),                           // @MethodComment(网络操作的重试策略，为nil则不重试，可使用DefaultRetryPolicy)
+		"CloneTimeout":      time.Duration(0),                              // @MethodComment(clone的超时时间，包括重试，为0则不限制)
+		"FetchTimeout":      time.Duration(0),                              // @MethodComment(fetch以及pull的超时时间，包括重试，为0则不限制)
+		"PushTimeout":       time.Duration(0),                              // @MethodComment(push的超时时间，包括重试，为0则不限制)
+		"StructuredLogger":  StructuredLogger(nil),                         // @MethodComment(结构化日志，为nil则以logfmt格式输出到Logger，可通过NewSlogLogger、NewSugaredLogger适配)
+		"LogLevel":          Level(LevelInfo),                              // @MethodComment(低于该级别的日志不输出，设置为LevelWarn可关闭操作成功的日志)
+		"Progress":          ProgressFunc(nil),                             // @MethodComment(clone、fetch、push以及LFS传输的进度回调，为nil则丢弃进度)
+		"Interceptor":       []Interceptor(nil),                            // @MethodComment(Cloner以及Repository操作的拦截器，按照添加的顺序调用，每次操作时读取当前配置，未配置拦截器以及Tracer时Open以及Clone的Repository不经过拦截器)
+		"Metrics":           Metrics(nil),                                  // @MethodComment(操作次数、错误、耗时以及传输字节数的指标，为nil则不统计，可使用NewPrometheusMetrics，git操作的字节数需要调用InstallMeteredTransports)
+		"Tracer":            Tracer(nil),                                   // @MethodComment(为Cloner以及Repository的操作创建span，为nil则不创建，仅对之后Open以及Clone的Repository生效)
+		"DryRun":            false,                                         // @MethodComment(为true时Push、PushWithOptions、DeleteBranch、DeleteTag、Branch.Push、Tag.Push以及MirrorSync仅计算并输出将要推送的refspec以及ref的更新，不连接远端，DeleteBranch、DeleteTag、Branch.Delete以及Tag.Delete不删除本地的分支以及标签)
 	}
 }
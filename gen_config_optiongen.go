@@ -7,16 +7,45 @@ import (
 	"log"
 	"os"
 	"sync/atomic"
+	"time"
 	"unsafe"
 )
 
 // Config should use NewConfig to initialize it
 type Config struct {
-	RsaPath   string `xconf:"rsa_path" usage:"rsa 绝对路径或者home目录下相对路径"`
-	Logger    Logger `xconf:"logger" usage:"日志输出"`
-	UserName  string `xconf:"user_name" usage:"config user.name"`
-	UserEmail string `xconf:"user_email" usage:"config user.email"`
-	Depth     int    `xconf:"depth" usage:"git depth"`
+	RsaPath           string           `xconf:"rsa_path" usage:"rsa 绝对路径或者home目录下相对路径"`
+	Logger            Logger           `xconf:"logger" usage:"日志输出，为nil则不输出"`
+	UserName          string           `xconf:"user_name" usage:"config user.name"`
+	UserEmail         string           `xconf:"user_email" usage:"config user.email"`
+	Depth             int              `xconf:"depth" usage:"git depth"`
+	Signer            Signer           `xconf:"signer" usage:"commit和annotated tag的签名器，为nil则不签名，可通过NewOpenPGPSigner或NewSSHSigner创建"`
+	VerifyKeyRing     string           `xconf:"verify_key_ring" usage:"Verify时使用的OpenPGP armored公钥环"`
+	AllowedSigners    []string         `xconf:"allowed_signers" usage:"Verify时允许的SSH签名公钥，authorized_keys格式"`
+	CommitTemplate    string           `xconf:"commit_template" usage:"commit message模板，text/template格式，可使用CommitTemplateData中的字段，为空则直接使用comment"`
+	SignOff           bool             `xconf:"sign_off" usage:"Commit时是否追加Signed-off-by trailer"`
+	ChangeID          bool             `xconf:"change_id" usage:"Commit时是否追加Change-Id trailer"`
+	CoAuthors         []string         `xconf:"co_authors" usage:"Commit时追加的Co-authored-by trailer，格式为name <email>"`
+	Trailers          []Trailer        `xconf:"trailers" usage:"Commit时追加的自定义trailer"`
+	SparsePaths       []string         `xconf:"sparse_paths" usage:"sparse checkout的目录，Clone时仅checkout这些目录并保存到仓库中，为空则checkout所有文件，Open时优先使用仓库中保存的目录"`
+	Filter            string           `xconf:"filter" usage:"partial clone的filter，如blob:none、blob:limit=<n>、tree:0，为空则完整clone，缺失的对象在访问时按需获取"`
+	RecurseSubmodules bool             `xconf:"recurse_submodules" usage:"Clone、CheckoutBranch、CheckoutTag以及Pull时是否初始化并递归更新submodule"`
+	LFS               bool             `xconf:"lfs" usage:"Clone、CheckoutBranch、CheckoutTag以及Pull后是否自动下载LFS对象并替换工作区中的pointer文件，以及Add、AddAll、RewriteFile时是否将被LFS管理的文件替换为pointer、Push时是否上传LFS对象，私有LFS服务仅支持通过LFSURL或者https remote地址中的userinfo认证，不支持ssh remote的git-lfs-authenticate"`
+	LFSURL            string           `xconf:"lfsurl" usage:"LFS服务地址，为空则依次使用git config中的lfs.url、.lfsconfig以及origin的url推导，地址中的userinfo作为HTTP basic认证的凭证"`
+	CacheDir          string           `xconf:"cache_dir" usage:"clone缓存目录，不为空时每个url在该目录中保存一份bare mirror，clone前fetch更新，并从本地mirror clone后将origin指回原url，多个进程可共享同一目录，更新mirror时通过文件锁串行，等待时间受LockTimeout限制"`
+	FileLock          bool             `xconf:"file_lock" usage:"Open的Repository在修改操作时是否获取.git/gittools.lock文件锁，用于协调多个进程对同一工作区的操作"`
+	LockTimeout       time.Duration    `xconf:"lock_timeout" usage:"等待文件锁的超时时间"`
+	LockStaleTimeout  time.Duration    `xconf:"lock_stale_timeout" usage:"文件锁超过该时间则视为过期并移除，为0则仅在持有锁的进程已退出时移除"`
+	RetryPolicy       *RetryPolicy     `xconf:"retry_policy" usage:"网络操作的重试策略，为nil则不重试，可使用DefaultRetryPolicy"`
+	CloneTimeout      time.Duration    `xconf:"clone_timeout" usage:"clone的超时时间，包括重试，为0则不限制"`
+	FetchTimeout      time.Duration    `xconf:"fetch_timeout" usage:"fetch以及pull的超时时间，包括重试，为0则不限制"`
+	PushTimeout       time.Duration    `xconf:"push_timeout" usage:"push的超时时间，包括重试，为0则不限制"`
+	StructuredLogger  StructuredLogger `xconf:"structured_logger" usage:"结构化日志，为nil则以logfmt格式输出到Logger，可通过NewSlogLogger、NewSugaredLogger适配"`
+	LogLevel          Level            `xconf:"log_level" usage:"低于该级别的日志不输出，设置为LevelWarn可关闭操作成功的日志"`
+	Progress          ProgressFunc     `xconf:"progress" usage:"clone、fetch、push以及LFS传输的进度回调，为nil则丢弃进度"`
+	Interceptor       []Interceptor    `xconf:"interceptor" usage:"Cloner以及Repository操作的拦截器，按照添加的顺序调用，每次操作时读取当前配置，未配置拦截器以及Tracer时Open以及Clone的Repository不经过拦截器"`
+	Metrics           Metrics          `xconf:"metrics" usage:"操作次数、错误、耗时以及传输字节数的指标，为nil则不统计，可使用NewPrometheusMetrics，git操作的字节数需要调用InstallMeteredTransports"`
+	Tracer            Tracer           `xconf:"tracer" usage:"为Cloner以及Repository的操作创建span，为nil则不创建，仅对之后Open以及Clone的Repository生效"`
+	DryRun            bool             `xconf:"dry_run" usage:"为true时Push、PushWithOptions、DeleteBranch、DeleteTag、Branch.Push、Tag.Push以及MirrorSync仅计算并输出将要推送的refspec以及ref的更新，不连接远端，DeleteBranch、DeleteTag、Branch.Delete以及Tag.Delete不删除本地的分支以及标签"`
 }
 
 // NewConfig new Config
@@ -55,7 +84,7 @@ func WithRsaPath(v string) ConfigOption {
 	}
 }
 
-// WithLogger 日志输出
+// WithLogger 日志输出，为nil则不输出
 func WithLogger(v Logger) ConfigOption {
 	return func(cc *Config) ConfigOption {
 		previous := cc.Logger
@@ -91,6 +120,258 @@ func WithDepth(v int) ConfigOption {
 	}
 }
 
+// WithSigner commit和annotated tag的签名器，为nil则不签名，可通过NewOpenPGPSigner或NewSSHSigner创建
+func WithSigner(v Signer) ConfigOption {
+	return func(cc *Config) ConfigOption {
+		previous := cc.Signer
+		cc.Signer = v
+		return WithSigner(previous)
+	}
+}
+
+// WithVerifyKeyRing Verify时使用的OpenPGP armored公钥环
+func WithVerifyKeyRing(v string) ConfigOption {
+	return func(cc *Config) ConfigOption {
+		previous := cc.VerifyKeyRing
+		cc.VerifyKeyRing = v
+		return WithVerifyKeyRing(previous)
+	}
+}
+
+// WithAllowedSigners Verify时允许的SSH签名公钥，authorized_keys格式
+func WithAllowedSigners(v ...string) ConfigOption {
+	return func(cc *Config) ConfigOption {
+		previous := cc.AllowedSigners
+		cc.AllowedSigners = v
+		return WithAllowedSigners(previous...)
+	}
+}
+
+// WithCommitTemplate commit message模板，text/template格式，可使用CommitTemplateData中的字段，为空则直接使用comment
+func WithCommitTemplate(v string) ConfigOption {
+	return func(cc *Config) ConfigOption {
+		previous := cc.CommitTemplate
+		cc.CommitTemplate = v
+		return WithCommitTemplate(previous)
+	}
+}
+
+// WithSignOff Commit时是否追加Signed-off-by trailer
+func WithSignOff(v bool) ConfigOption {
+	return func(cc *Config) ConfigOption {
+		previous := cc.SignOff
+		cc.SignOff = v
+		return WithSignOff(previous)
+	}
+}
+
+// WithChangeID Commit时是否追加Change-Id trailer
+func WithChangeID(v bool) ConfigOption {
+	return func(cc *Config) ConfigOption {
+		previous := cc.ChangeID
+		cc.ChangeID = v
+		return WithChangeID(previous)
+	}
+}
+
+// WithCoAuthors Commit时追加的Co-authored-by trailer，格式为name <email>
+func WithCoAuthors(v ...string) ConfigOption {
+	return func(cc *Config) ConfigOption {
+		previous := cc.CoAuthors
+		cc.CoAuthors = v
+		return WithCoAuthors(previous...)
+	}
+}
+
+// WithTrailers Commit时追加的自定义trailer
+func WithTrailers(v ...Trailer) ConfigOption {
+	return func(cc *Config) ConfigOption {
+		previous := cc.Trailers
+		cc.Trailers = v
+		return WithTrailers(previous...)
+	}
+}
+
+// WithSparsePaths sparse checkout的目录，Clone时仅checkout这些目录并保存到仓库中，为空则checkout所有文件，Open时优先使用仓库中保存的目录
+func WithSparsePaths(v ...string) ConfigOption {
+	return func(cc *Config) ConfigOption {
+		previous := cc.SparsePaths
+		cc.SparsePaths = v
+		return WithSparsePaths(previous...)
+	}
+}
+
+// WithFilter partial clone的filter，如blob:none、blob:limit=<n>、tree:0，为空则完整clone，缺失的对象在访问时按需获取
+func WithFilter(v string) ConfigOption {
+	return func(cc *Config) ConfigOption {
+		previous := cc.Filter
+		cc.Filter = v
+		return WithFilter(previous)
+	}
+}
+
+// WithRecurseSubmodules Clone、CheckoutBranch、CheckoutTag以及Pull时是否初始化并递归更新submodule
+func WithRecurseSubmodules(v bool) ConfigOption {
+	return func(cc *Config) ConfigOption {
+		previous := cc.RecurseSubmodules
+		cc.RecurseSubmodules = v
+		return WithRecurseSubmodules(previous)
+	}
+}
+
+// WithLFS Clone、CheckoutBranch、CheckoutTag以及Pull后是否自动下载LFS对象并替换工作区中的pointer文件，以及Add、AddAll、RewriteFile时是否将被LFS管理的文件替换为pointer、Push时是否上传LFS对象，私有LFS服务仅支持通过LFSURL或者https remote地址中的userinfo认证，不支持ssh remote的git-lfs-authenticate
+func WithLFS(v bool) ConfigOption {
+	return func(cc *Config) ConfigOption {
+		previous := cc.LFS
+		cc.LFS = v
+		return WithLFS(previous)
+	}
+}
+
+// WithLFSURL LFS服务地址，为空则依次使用git config中的lfs.url、.lfsconfig以及origin的url推导，地址中的userinfo作为HTTP basic认证的凭证
+func WithLFSURL(v string) ConfigOption {
+	return func(cc *Config) ConfigOption {
+		previous := cc.LFSURL
+		cc.LFSURL = v
+		return WithLFSURL(previous)
+	}
+}
+
+// WithCacheDir clone缓存目录，不为空时每个url在该目录中保存一份bare mirror，clone前fetch更新，并从本地mirror clone后将origin指回原url，多个进程可共享同一目录，更新mirror时通过文件锁串行，等待时间受LockTimeout限制
+func WithCacheDir(v string) ConfigOption {
+	return func(cc *Config) ConfigOption {
+		previous := cc.CacheDir
+		cc.CacheDir = v
+		return WithCacheDir(previous)
+	}
+}
+
+// WithFileLock Open的Repository在修改操作时是否获取.git/gittools.lock文件锁，用于协调多个进程对同一工作区的操作
+func WithFileLock(v bool) ConfigOption {
+	return func(cc *Config) ConfigOption {
+		previous := cc.FileLock
+		cc.FileLock = v
+		return WithFileLock(previous)
+	}
+}
+
+// WithLockTimeout 等待文件锁的超时时间
+func WithLockTimeout(v time.Duration) ConfigOption {
+	return func(cc *Config) ConfigOption {
+		previous := cc.LockTimeout
+		cc.LockTimeout = v
+		return WithLockTimeout(previous)
+	}
+}
+
+// WithLockStaleTimeout 文件锁超过该时间则视为过期并移除，为0则仅在持有锁的进程已退出时移除
+func WithLockStaleTimeout(v time.Duration) ConfigOption {
+	return func(cc *Config) ConfigOption {
+		previous := cc.LockStaleTimeout
+		cc.LockStaleTimeout = v
+		return WithLockStaleTimeout(previous)
+	}
+}
+
+// WithRetryPolicy 网络操作的重试策略，为nil则不重试，可使用DefaultRetryPolicy
+func WithRetryPolicy(v *RetryPolicy) ConfigOption {
+	return func(cc *Config) ConfigOption {
+		previous := cc.RetryPolicy
+		cc.RetryPolicy = v
+		return WithRetryPolicy(previous)
+	}
+}
+
+// WithCloneTimeout clone的超时时间，包括重试，为0则不限制
+func WithCloneTimeout(v time.Duration) ConfigOption {
+	return func(cc *Config) ConfigOption {
+		previous := cc.CloneTimeout
+		cc.CloneTimeout = v
+		return WithCloneTimeout(previous)
+	}
+}
+
+// WithFetchTimeout fetch以及pull的超时时间，包括重试，为0则不限制
+func WithFetchTimeout(v time.Duration) ConfigOption {
+	return func(cc *Config) ConfigOption {
+		previous := cc.FetchTimeout
+		cc.FetchTimeout = v
+		return WithFetchTimeout(previous)
+	}
+}
+
+// WithPushTimeout push的超时时间，包括重试，为0则不限制
+func WithPushTimeout(v time.Duration) ConfigOption {
+	return func(cc *Config) ConfigOption {
+		previous := cc.PushTimeout
+		cc.PushTimeout = v
+		return WithPushTimeout(previous)
+	}
+}
+
+// WithStructuredLogger 结构化日志，为nil则以logfmt格式输出到Logger，可通过NewSlogLogger、NewSugaredLogger适配
+func WithStructuredLogger(v StructuredLogger) ConfigOption {
+	return func(cc *Config) ConfigOption {
+		previous := cc.StructuredLogger
+		cc.StructuredLogger = v
+		return WithStructuredLogger(previous)
+	}
+}
+
+// WithLogLevel 低于该级别的日志不输出，设置为LevelWarn可关闭操作成功的日志
+func WithLogLevel(v Level) ConfigOption {
+	return func(cc *Config) ConfigOption {
+		previous := cc.LogLevel
+		cc.LogLevel = v
+		return WithLogLevel(previous)
+	}
+}
+
+// WithProgress clone、fetch、push以及LFS传输的进度回调，为nil则丢弃进度
+func WithProgress(v ProgressFunc) ConfigOption {
+	return func(cc *Config) ConfigOption {
+		previous := cc.Progress
+		cc.Progress = v
+		return WithProgress(previous)
+	}
+}
+
+// WithInterceptor Cloner以及Repository操作的拦截器，按照添加的顺序调用，每次操作时读取当前配置，未配置拦截器以及Tracer时Open以及Clone的Repository不经过拦截器
+func WithInterceptor(v ...Interceptor) ConfigOption {
+	return func(cc *Config) ConfigOption {
+		previous := cc.Interceptor
+		cc.Interceptor = v
+		return WithInterceptor(previous...)
+	}
+}
+
+// WithMetrics 操作次数、错误、耗时以及传输字节数的指标，为nil则不统计，可使用NewPrometheusMetrics，git操作的字节数需要调用InstallMeteredTransports
+func WithMetrics(v Metrics) ConfigOption {
+	return func(cc *Config) ConfigOption {
+		previous := cc.Metrics
+		cc.Metrics = v
+		return WithMetrics(previous)
+	}
+}
+
+// WithTracer 为Cloner以及Repository的操作创建span，为nil则不创建，仅对之后Open以及Clone的Repository生效
+func WithTracer(v Tracer) ConfigOption {
+	return func(cc *Config) ConfigOption {
+		previous := cc.Tracer
+		cc.Tracer = v
+		return WithTracer(previous)
+	}
+}
+
+// WithDryRun 为true时Push、PushWithOptions、DeleteBranch、DeleteTag、Branch.Push、Tag.Push以及MirrorSync仅计算并输出将要推送的refspec以及ref的更新，不连接远端，DeleteBranch、DeleteTag、Branch.Delete以及Tag.Delete不删除本地的分支以及标签
+func WithDryRun(v bool) ConfigOption {
+	return func(cc *Config) ConfigOption {
+		previous := cc.DryRun
+		cc.DryRun = v
+		return WithDryRun(previous)
+	}
+}
+
 // InstallConfigWatchDog the installed func will called when NewConfig  called
 func InstallConfigWatchDog(dog func(cc *Config)) { watchDogConfig = dog }
 
@@ -107,6 +388,34 @@ func newDefaultConfig() *Config {
 		WithUserName(""),
 		WithUserEmail(""),
 		WithDepth(1),
+		WithSigner(nil),
+		WithVerifyKeyRing(""),
+		WithAllowedSigners(nil...),
+		WithCommitTemplate(""),
+		WithSignOff(false),
+		WithChangeID(false),
+		WithCoAuthors(nil...),
+		WithTrailers(nil...),
+		WithSparsePaths(nil...),
+		WithFilter(""),
+		WithRecurseSubmodules(false),
+		WithLFS(false),
+		WithLFSURL(""),
+		WithCacheDir(""),
+		WithFileLock(false),
+		WithLockTimeout(time.Minute),
+		WithLockStaleTimeout(0),
+		WithRetryPolicy(nil),
+		WithCloneTimeout(time.Duration(0)),
+		WithFetchTimeout(time.Duration(0)),
+		WithPushTimeout(time.Duration(0)),
+		WithStructuredLogger(StructuredLogger(nil)),
+		WithLogLevel(Level(LevelInfo)),
+		WithProgress(ProgressFunc(nil)),
+		WithInterceptor(nil...),
+		WithMetrics(Metrics(nil)),
+		WithTracer(Tracer(nil)),
+		WithDryRun(false),
 	} {
 		opt(cc)
 	}
@@ -154,11 +463,39 @@ func AtomicConfig() ConfigVisitor {
 }
 
 // all getter func
-func (cc *Config) GetRsaPath() string   { return cc.RsaPath }
-func (cc *Config) GetLogger() Logger    { return cc.Logger }
-func (cc *Config) GetUserName() string  { return cc.UserName }
-func (cc *Config) GetUserEmail() string { return cc.UserEmail }
-func (cc *Config) GetDepth() int        { return cc.Depth }
+func (cc *Config) GetRsaPath() string                    { return cc.RsaPath }
+func (cc *Config) GetLogger() Logger                     { return cc.Logger }
+func (cc *Config) GetUserName() string                   { return cc.UserName }
+func (cc *Config) GetUserEmail() string                  { return cc.UserEmail }
+func (cc *Config) GetDepth() int                         { return cc.Depth }
+func (cc *Config) GetSigner() Signer                     { return cc.Signer }
+func (cc *Config) GetVerifyKeyRing() string              { return cc.VerifyKeyRing }
+func (cc *Config) GetAllowedSigners() []string           { return cc.AllowedSigners }
+func (cc *Config) GetCommitTemplate() string             { return cc.CommitTemplate }
+func (cc *Config) GetSignOff() bool                      { return cc.SignOff }
+func (cc *Config) GetChangeID() bool                     { return cc.ChangeID }
+func (cc *Config) GetCoAuthors() []string                { return cc.CoAuthors }
+func (cc *Config) GetTrailers() []Trailer                { return cc.Trailers }
+func (cc *Config) GetSparsePaths() []string              { return cc.SparsePaths }
+func (cc *Config) GetFilter() string                     { return cc.Filter }
+func (cc *Config) GetRecurseSubmodules() bool            { return cc.RecurseSubmodules }
+func (cc *Config) GetLFS() bool                          { return cc.LFS }
+func (cc *Config) GetLFSURL() string                     { return cc.LFSURL }
+func (cc *Config) GetCacheDir() string                   { return cc.CacheDir }
+func (cc *Config) GetFileLock() bool                     { return cc.FileLock }
+func (cc *Config) GetLockTimeout() time.Duration         { return cc.LockTimeout }
+func (cc *Config) GetLockStaleTimeout() time.Duration    { return cc.LockStaleTimeout }
+func (cc *Config) GetRetryPolicy() *RetryPolicy          { return cc.RetryPolicy }
+func (cc *Config) GetCloneTimeout() time.Duration        { return cc.CloneTimeout }
+func (cc *Config) GetFetchTimeout() time.Duration        { return cc.FetchTimeout }
+func (cc *Config) GetPushTimeout() time.Duration         { return cc.PushTimeout }
+func (cc *Config) GetStructuredLogger() StructuredLogger { return cc.StructuredLogger }
+func (cc *Config) GetLogLevel() Level                    { return cc.LogLevel }
+func (cc *Config) GetProgress() ProgressFunc             { return cc.Progress }
+func (cc *Config) GetInterceptor() []Interceptor         { return cc.Interceptor }
+func (cc *Config) GetMetrics() Metrics                   { return cc.Metrics }
+func (cc *Config) GetTracer() Tracer                     { return cc.Tracer }
+func (cc *Config) GetDryRun() bool                       { return cc.DryRun }
 
 // ConfigVisitor visitor interface for Config
 type ConfigVisitor interface {
@@ -167,6 +504,34 @@ type ConfigVisitor interface {
 	GetUserName() string
 	GetUserEmail() string
 	GetDepth() int
+	GetSigner() Signer
+	GetVerifyKeyRing() string
+	GetAllowedSigners() []string
+	GetCommitTemplate() string
+	GetSignOff() bool
+	GetChangeID() bool
+	GetCoAuthors() []string
+	GetTrailers() []Trailer
+	GetSparsePaths() []string
+	GetFilter() string
+	GetRecurseSubmodules() bool
+	GetLFS() bool
+	GetLFSURL() string
+	GetCacheDir() string
+	GetFileLock() bool
+	GetLockTimeout() time.Duration
+	GetLockStaleTimeout() time.Duration
+	GetRetryPolicy() *RetryPolicy
+	GetCloneTimeout() time.Duration
+	GetFetchTimeout() time.Duration
+	GetPushTimeout() time.Duration
+	GetStructuredLogger() StructuredLogger
+	GetLogLevel() Level
+	GetProgress() ProgressFunc
+	GetInterceptor() []Interceptor
+	GetMetrics() Metrics
+	GetTracer() Tracer
+	GetDryRun() bool
 }
 
 // ConfigInterface visitor + ApplyOption interface for Config
@@ -5,19 +5,20 @@ import (
 )
 
 type Branch interface {
-	// Delete 删除本地分支
+	// Delete 删除本地分支，DryRun时保留本地分支
 	Delete(ctx context.Context) error
 	// Push git push，如果本地被删除，push后，远端也将删除
 	Push(ctx context.Context) error
 }
 
 type Tag interface {
-	// Delete 删除本地标签
+	// Delete 删除本地标签，DryRun时保留本地标签
 	Delete(ctx context.Context) error
 	// Push git push，如果本地被标签，push后，远端也将删除
 	Push(ctx context.Context) error
 }
 
+// Repository 可以在多个goroutine中使用，同一Repository的操作会串行执行
 type Repository interface {
 	// UserName 获取.git/config的user.name
 	UserName() string
@@ -32,12 +33,16 @@ type Repository interface {
 	// IsClean Repository是否有未提交的文件
 	IsClean() (bool, error)
 
-	// Pull git pull
-	Pull(ctx context.Context) error
-	// Push git push
-	Push(ctx context.Context) error
-	// Commit git commit -m ""
+	// Pull git pull，若remote为空，则为origin，无法fast-forward时返回SyncDiverged以及ErrNonFastForwardUpdate
+	Pull(ctx context.Context, remote string) (*SyncResult, error)
+	// Push git push，若remote为空，则为origin，被拒绝时返回SyncRejected以及错误
+	Push(ctx context.Context, remote string) (*SyncResult, error)
+	// PushWithOptions 根据options推送，返回每个ref的推送结果
+	PushWithOptions(ctx context.Context, opts PushOptions) ([]RefUpdate, error)
+	// Commit git commit -m ""，会根据配置渲染CommitTemplate并追加trailer
 	Commit(ctx context.Context, comment string) error
+	// Trailers 解析rev对应commit message中的trailer
+	Trailers(ctx context.Context, rev string) ([]Trailer, error)
 
 	// IsIgnoreDir 是否是忽略的目录
 	IsIgnoreDir(ctx context.Context, dirs ...string) (bool, error)
@@ -49,11 +54,15 @@ type Repository interface {
 	Add(ctx context.Context, fileOrDirs ...string) error
 	// AddAll 添加根目录下所有文件或目录
 	AddAll(ctx context.Context, excludes ...string) error
-	// RewriteFile 重写文件内容，不存在则创建
+	// RewriteFile 重写文件内容，不存在则创建，不在sparse checkout的目录中时返回ErrOutsideSparsePaths
 	RewriteFile(ctx context.Context, file string, data []byte) error
 
-	// CheckoutBranch checkout分支，若branch为空，则checkout master分支
-	CheckoutBranch(ctx context.Context, branch string) error
+	// SetSparsePaths 设置sparse checkout的目录，工作区仅保留这些目录中的文件，为空则checkout所有文件
+	// 目录保存在.git/info/sparse-checkout中，之后Open时使用保存的目录
+	SetSparsePaths(ctx context.Context, paths ...string) error
+
+	// CheckoutBranch checkout remote的分支，若branch为空，则checkout master分支，若remote为空，则为origin
+	CheckoutBranch(ctx context.Context, branch, remote string) error
 	// Branch 获取分支
 	Branch(ctx context.Context, branch string) (Branch, error)
 	// CreateBranch 根据hash创建分支，若不指定hash，则为当前head hash
@@ -74,10 +83,39 @@ type Repository interface {
 	// DeleteTag 删除本地和远程标签
 	DeleteTag(ctx context.Context, tag string) error
 
-	// Fetch git fetch
-	Fetch(ctx context.Context) error
+	// Fetch git fetch，若remote为空，则为origin
+	Fetch(ctx context.Context, remote string) (*SyncResult, error)
+	// FetchWithOptions 根据options fetch，可指定分支、标签、prune、标签跟随模式、加深或取消shallow
+	FetchWithOptions(ctx context.Context, opts FetchOptions) (*SyncResult, error)
+
+	// Remotes 获取所有的remote
+	Remotes(ctx context.Context) ([]Remote, error)
+	// AddRemote 添加remote
+	AddRemote(ctx context.Context, name string, urls ...string) error
+	// RemoveRemote 删除remote
+	RemoveRemote(ctx context.Context, name string) error
+	// SetRemoteURL 设置remote的url
+	SetRemoteURL(ctx context.Context, name string, urls ...string) error
+
+	// Submodules 获取所有submodule的信息以及状态
+	Submodules(ctx context.Context) ([]Submodule, error)
+	// UpdateSubmodules 更新submodule到父仓库记录的commit，等同于git submodule update
+	UpdateSubmodules(ctx context.Context, opts SubmoduleUpdateOptions) error
+	// LFSFiles 返回工作区中被LFS管理的文件，bare仓库或者未使用LFS时返回空
+	LFSFiles(ctx context.Context) ([]LFSFile, error)
+	// LFSPull 下载工作区中仍是pointer的LFS文件，等同于git lfs pull
+	LFSPull(ctx context.Context) error
+
+	// MirrorSync 同步mirror仓库，从origin fetch并prune所有ref，若存在名为mirror(MirrorRemoteName)的remote，则镜像推送到该remote
+	// 镜像推送的目标地址需要先通过AddRemote(ctx, MirrorRemoteName, url)添加，通过SetRemoteURL修改
+	// 仅支持CloneMirror创建的bare mirror仓库，否则返回ErrNotMirror，避免覆盖工作区所在的分支或者普通bare仓库的ref
+	MirrorSync(ctx context.Context) error
+
+	// Verify 校验rev(commit或者tag)的签名，OpenPGP签名使用VerifyKeyRing校验，SSH签名使用AllowedSigners校验
+	Verify(ctx context.Context, rev string) error
 }
 
+// Cloner 可以在多个goroutine中使用，但ApplyOption修改配置不是并发安全的
 type Cloner interface {
 	// Open 获取指定路径下的Repository
 	Open(ctx context.Context, dir string) (Repository, error)
@@ -85,10 +123,16 @@ type Cloner interface {
 	Clone(ctx context.Context, url, dir string) (Repository, error)
 	// CloneOnlyBranch 克隆指定的url指定的branch的Repository到本地dir目录，若dir为空，则为临时目录（临时目录可以通过Repository.Root()获取）
 	CloneOnlyBranch(ctx context.Context, url, dir, branch string) (Repository, error)
+	// CloneBare 克隆指定的url的bare Repository到本地dir目录，若dir为空，则为临时目录
+	CloneBare(ctx context.Context, url, dir string) (Repository, error)
+	// CloneMirror 以mirror方式克隆指定的url的Repository到本地dir目录，镜像所有ref，若dir为空，则为临时目录
+	CloneMirror(ctx context.Context, url, dir string) (Repository, error)
 	// CloneToMemory 克隆指定的url的Repository到缓存中
 	CloneToMemory(ctx context.Context, url string) (Repository, error)
 	// CloneOnlyBranchToMemory 克隆指定的url指定的branch的Repository到缓存中
 	CloneOnlyBranchToMemory(ctx context.Context, url, branch string) (Repository, error)
+	// NewPool 创建url的工作区池，工作区在首次Acquire时clone，归还后复用
+	NewPool(url string, opts PoolOptions) Pool
 	// ConfigInterface visitor + ApplyOption interface for Config
 	ConfigInterface
 }
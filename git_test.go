@@ -3,7 +3,10 @@ package gittools
 import (
 	"context"
 	"fmt"
+	git "github.com/go-git/go-git/v5"
 	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
 	"testing"
 	"time"
 )
@@ -19,13 +22,13 @@ func TestGit(t *testing.T) {
 		So(r, ShouldNotBeNil)
 		So(r.UserName(), ShouldEqual, userName)
 
-		err = r.CheckoutBranch(context.Background(), "")
+		err = r.CheckoutBranch(context.Background(), "", "")
 		So(err, ShouldBeNil)
-		err = r.Fetch(context.Background())
+		_, err = r.Fetch(context.Background(), "")
 		So(err, ShouldBeNil)
-		err = r.CheckoutBranch(context.Background(), "version/1.0")
+		err = r.CheckoutBranch(context.Background(), "version/1.0", "")
 		So(err, ShouldBeNil)
-		err = r.CheckoutBranch(context.Background(), "version/1.1")
+		err = r.CheckoutBranch(context.Background(), "version/1.1", "")
 		So(err, ShouldBeNil)
 
 		err = r.CheckoutTag(context.Background(), "")
@@ -44,17 +47,17 @@ func TestGit(t *testing.T) {
 		r, err = g.Clone(context.Background(), "git@github.com:sandwich-go/go-redis-client-benchmark.git", "")
 		So(err, ShouldBeNil)
 		So(r, ShouldNotBeNil)
-		err = r.Fetch(context.Background())
+		_, err = r.Fetch(context.Background(), "")
 		So(err, ShouldBeNil)
-		err = r.Pull(context.Background())
+		_, err = r.Pull(context.Background(), "")
 		So(err, ShouldBeNil)
-		err = r.Push(context.Background())
+		_, err = r.Push(context.Background(), "")
 		So(err, ShouldBeNil)
 		err = r.RewriteFile(context.Background(), fileName, fileContent)
 		So(err, ShouldBeNil)
 		err = r.Commit(context.Background(), commitMsg)
 		So(err, ShouldBeNil)
-		err = r.Push(context.Background())
+		_, err = r.Push(context.Background(), "")
 		So(err, ShouldBeNil)
 		b, err = r.CreateBranch(context.Background(), newBranchName, "")
 		So(err, ShouldBeNil)
@@ -91,3 +94,40 @@ func TestGit(t *testing.T) {
 		So(err, ShouldBeNil)
 	})
 }
+
+// newLocalRepository 在临时目录中初始化一个本地仓库，并提交一个初始文件
+func newLocalRepository(t *testing.T, opts ...ConfigOption) (Cloner, Repository) {
+	dir, err := ioutil.TempDir("", "gittools")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	if _, err = git.PlainInit(dir, false); err != nil {
+		t.Fatal(err)
+	}
+	g := New(append([]ConfigOption{WithUserName("botman"), WithUserEmail("botman@sandwich.com")}, opts...)...)
+	var r Repository
+	if r, err = g.Open(context.Background(), dir); err != nil {
+		t.Fatal(err)
+	}
+	if err = r.RewriteFile(context.Background(), "README.md", []byte("init")); err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Commit(context.Background(), "init"); err != nil {
+		t.Fatal(err)
+	}
+	return g, r
+}
+
+// newBareRemote 在临时目录中初始化一个bare仓库，用作本地remote
+func newBareRemote(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "gittools")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	if _, err = git.PlainInit(dir, true); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
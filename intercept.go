@@ -0,0 +1,384 @@
+package gittools
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrOperationVetoed 拦截器没有调用next，也没有返回错误或者设置Result，用于有返回值的操作
+var ErrOperationVetoed = errors.New("operation vetoed by interceptor")
+
+// Operation Cloner或Repository的一次操作
+type Operation struct {
+	// Name 操作名称，与方法名一致，如Clone、Push，Branch以及Tag的操作为Branch.Push、Tag.Delete等
+	Name string
+	// Args 除ctx以外的参数，可变参数为一个切片，拦截器可以在调用next前修改，但类型必须保持一致
+	Args []interface{}
+	// Repository 操作所属的Repository，Cloner的操作为nil，调用其方法不会再经过拦截器
+	Repository Repository
+	// Ref 操作开始时Repository当前的ref，如refs/heads/master，Cloner的操作为空
+	Ref string
+	// Result 除error以外的返回值，没有返回值时为nil，拦截器可以在next返回后读取或者替换
+	Result interface{}
+}
+
+// Handler 执行操作
+type Handler func(ctx context.Context, op *Operation) error
+
+// Interceptor 拦截Cloner以及Repository带有ctx参数的操作，调用next继续执行，不调用next并返回错误则拒绝执行
+// 可以修改传递给next的ctx、op.Args，以及next返回后的op.Result和错误
+// 有返回值的操作不调用next时需要设置op.Result，否则返回ErrOperationVetoed
+type Interceptor func(ctx context.Context, op *Operation, next Handler) error
+
+// intercepting 是否配置了拦截器或者Tracer
+func (h *cloner) intercepting() bool {
+	return len(h.GetInterceptor()) > 0 || h.GetTracer() != nil
+}
+
+// intercept 配置了Tracer时先创建span，再按照添加的顺序调用拦截器，最后调用f
+func (h *cloner) intercept(ctx context.Context, op *Operation, f Handler) error {
+	interceptors := h.GetInterceptor()
+	next := f
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, n := interceptors[i], next
+		next = func(ctx context.Context, op *Operation) error { return interceptor(ctx, op, n) }
+	}
+	return h.trace(ctx, op, next)
+}
+
+// invoke 执行Cloner的操作，配置了拦截器或者Tracer时返回的Repository的操作也会经过拦截器
+func (h *cloner) invoke(ctx context.Context, name string, args []interface{}, f func(ctx context.Context, args []interface{}) (Repository, error)) (Repository, error) {
+	if !h.intercepting() {
+		return f(ctx, args)
+	}
+	op := &Operation{Name: name, Args: args}
+	err := h.intercept(ctx, op, func(ctx context.Context, op *Operation) (err error) {
+		var repo Repository
+		if repo, err = f(ctx, op.Args); repo != nil {
+			op.Result = repo
+		}
+		return
+	})
+	if err == nil && op.Result == nil {
+		return nil, ErrOperationVetoed
+	}
+	switch repo := op.Result.(type) {
+	case *repository:
+		return &interceptedRepository{r: repo}, err
+	case Repository:
+		return repo, err
+	}
+	return nil, err
+}
+
+// interceptedRepository 配置了拦截器或者Tracer时Open以及Clone返回的Repository
+type interceptedRepository struct {
+	r *repository
+}
+
+// call 经过拦截器执行Repository的操作
+func (ir *interceptedRepository) call(ctx context.Context, name string, args []interface{}, f func(ctx context.Context, args []interface{}) (interface{}, error)) (*Operation, error) {
+	op := &Operation{Name: name, Args: args, Repository: ir.r, Ref: ir.r.ref()}
+	err := ir.r.h.intercept(ctx, op, func(ctx context.Context, op *Operation) (err error) {
+		op.Result, err = f(ctx, op.Args)
+		return
+	})
+	return op, err
+}
+
+// invoke 执行有返回值的操作，拦截器没有调用next也没有设置Result时返回ErrOperationVetoed
+func (ir *interceptedRepository) invoke(ctx context.Context, name string, args []interface{}, f func(ctx context.Context, args []interface{}) (interface{}, error)) (interface{}, error) {
+	op, err := ir.call(ctx, name, args, f)
+	if err == nil && op.Result == nil {
+		err = ErrOperationVetoed
+	}
+	return op.Result, err
+}
+
+// invokeErr 执行只返回error的操作
+func (ir *interceptedRepository) invokeErr(ctx context.Context, name string, args []interface{}, f func(ctx context.Context, args []interface{}) error) error {
+	_, err := ir.call(ctx, name, args, func(ctx context.Context, args []interface{}) (interface{}, error) {
+		return nil, f(ctx, args)
+	})
+	return err
+}
+
+func (ir *interceptedRepository) UserName() string  { return ir.r.UserName() }
+func (ir *interceptedRepository) UserEmail() string { return ir.r.UserEmail() }
+func (ir *interceptedRepository) Root() string      { return ir.r.Root() }
+func (ir *interceptedRepository) RemoveAll() error  { return ir.r.RemoveAll() }
+
+func (ir *interceptedRepository) IsClean() (bool, error) { return ir.r.IsClean() }
+
+func (ir *interceptedRepository) Pull(ctx context.Context, remote string) (*SyncResult, error) {
+	res, err := ir.invoke(ctx, "Pull", []interface{}{remote}, func(ctx context.Context, args []interface{}) (interface{}, error) {
+		return ir.r.Pull(ctx, args[0].(string))
+	})
+	sr, _ := res.(*SyncResult)
+	return sr, err
+}
+
+func (ir *interceptedRepository) Push(ctx context.Context, remote string) (*SyncResult, error) {
+	res, err := ir.invoke(ctx, "Push", []interface{}{remote}, func(ctx context.Context, args []interface{}) (interface{}, error) {
+		return ir.r.Push(ctx, args[0].(string))
+	})
+	sr, _ := res.(*SyncResult)
+	return sr, err
+}
+
+func (ir *interceptedRepository) PushWithOptions(ctx context.Context, opts PushOptions) ([]RefUpdate, error) {
+	res, err := ir.invoke(ctx, "PushWithOptions", []interface{}{opts}, func(ctx context.Context, args []interface{}) (interface{}, error) {
+		return ir.r.PushWithOptions(ctx, args[0].(PushOptions))
+	})
+	updates, _ := res.([]RefUpdate)
+	return updates, err
+}
+
+func (ir *interceptedRepository) Commit(ctx context.Context, comment string) error {
+	return ir.invokeErr(ctx, "Commit", []interface{}{comment}, func(ctx context.Context, args []interface{}) error {
+		return ir.r.Commit(ctx, args[0].(string))
+	})
+}
+
+func (ir *interceptedRepository) Trailers(ctx context.Context, rev string) ([]Trailer, error) {
+	res, err := ir.invoke(ctx, "Trailers", []interface{}{rev}, func(ctx context.Context, args []interface{}) (interface{}, error) {
+		return ir.r.Trailers(ctx, args[0].(string))
+	})
+	trailers, _ := res.([]Trailer)
+	return trailers, err
+}
+
+func (ir *interceptedRepository) IsIgnoreDir(ctx context.Context, dirs ...string) (bool, error) {
+	res, err := ir.invoke(ctx, "IsIgnoreDir", []interface{}{dirs}, func(ctx context.Context, args []interface{}) (interface{}, error) {
+		return ir.r.IsIgnoreDir(ctx, args[0].([]string)...)
+	})
+	ignored, _ := res.(bool)
+	return ignored, err
+}
+
+func (ir *interceptedRepository) IsIgnoreFile(ctx context.Context, files ...string) (bool, error) {
+	res, err := ir.invoke(ctx, "IsIgnoreFile", []interface{}{files}, func(ctx context.Context, args []interface{}) (interface{}, error) {
+		return ir.r.IsIgnoreFile(ctx, args[0].([]string)...)
+	})
+	ignored, _ := res.(bool)
+	return ignored, err
+}
+
+func (ir *interceptedRepository) Ignore(ctx context.Context, patterns ...string) error {
+	return ir.invokeErr(ctx, "Ignore", []interface{}{patterns}, func(ctx context.Context, args []interface{}) error {
+		return ir.r.Ignore(ctx, args[0].([]string)...)
+	})
+}
+
+func (ir *interceptedRepository) Add(ctx context.Context, fileOrDirs ...string) error {
+	return ir.invokeErr(ctx, "Add", []interface{}{fileOrDirs}, func(ctx context.Context, args []interface{}) error {
+		return ir.r.Add(ctx, args[0].([]string)...)
+	})
+}
+
+func (ir *interceptedRepository) AddAll(ctx context.Context, excludes ...string) error {
+	return ir.invokeErr(ctx, "AddAll", []interface{}{excludes}, func(ctx context.Context, args []interface{}) error {
+		return ir.r.AddAll(ctx, args[0].([]string)...)
+	})
+}
+
+func (ir *interceptedRepository) RewriteFile(ctx context.Context, file string, data []byte) error {
+	return ir.invokeErr(ctx, "RewriteFile", []interface{}{file, data}, func(ctx context.Context, args []interface{}) error {
+		return ir.r.RewriteFile(ctx, args[0].(string), args[1].([]byte))
+	})
+}
+
+func (ir *interceptedRepository) SetSparsePaths(ctx context.Context, paths ...string) error {
+	return ir.invokeErr(ctx, "SetSparsePaths", []interface{}{paths}, func(ctx context.Context, args []interface{}) error {
+		return ir.r.SetSparsePaths(ctx, args[0].([]string)...)
+	})
+}
+
+func (ir *interceptedRepository) CheckoutBranch(ctx context.Context, branch, remote string) error {
+	return ir.invokeErr(ctx, "CheckoutBranch", []interface{}{branch, remote}, func(ctx context.Context, args []interface{}) error {
+		return ir.r.CheckoutBranch(ctx, args[0].(string), args[1].(string))
+	})
+}
+
+func (ir *interceptedRepository) Branch(ctx context.Context, branch string) (Branch, error) {
+	res, err := ir.invoke(ctx, "Branch", []interface{}{branch}, func(ctx context.Context, args []interface{}) (interface{}, error) {
+		return ir.wrapBranch(ir.r.Branch(ctx, args[0].(string)))
+	})
+	b, _ := res.(Branch)
+	return b, err
+}
+
+func (ir *interceptedRepository) CreateBranch(ctx context.Context, branch string, hash string) (Branch, error) {
+	res, err := ir.invoke(ctx, "CreateBranch", []interface{}{branch, hash}, func(ctx context.Context, args []interface{}) (interface{}, error) {
+		return ir.wrapBranch(ir.r.CreateBranch(ctx, args[0].(string), args[1].(string)))
+	})
+	b, _ := res.(Branch)
+	return b, err
+}
+
+func (ir *interceptedRepository) DeleteLocalBranch(ctx context.Context, branch string) error {
+	return ir.invokeErr(ctx, "DeleteLocalBranch", []interface{}{branch}, func(ctx context.Context, args []interface{}) error {
+		return ir.r.DeleteLocalBranch(ctx, args[0].(string))
+	})
+}
+
+func (ir *interceptedRepository) DeleteBranch(ctx context.Context, branch string) error {
+	return ir.invokeErr(ctx, "DeleteBranch", []interface{}{branch}, func(ctx context.Context, args []interface{}) error {
+		return ir.r.DeleteBranch(ctx, args[0].(string))
+	})
+}
+
+func (ir *interceptedRepository) CheckoutTag(ctx context.Context, tag string) error {
+	return ir.invokeErr(ctx, "CheckoutTag", []interface{}{tag}, func(ctx context.Context, args []interface{}) error {
+		return ir.r.CheckoutTag(ctx, args[0].(string))
+	})
+}
+
+func (ir *interceptedRepository) Tag(ctx context.Context, tagName string) (Tag, error) {
+	res, err := ir.invoke(ctx, "Tag", []interface{}{tagName}, func(ctx context.Context, args []interface{}) (interface{}, error) {
+		return ir.wrapTag(ir.r.Tag(ctx, args[0].(string)))
+	})
+	t, _ := res.(Tag)
+	return t, err
+}
+
+func (ir *interceptedRepository) CreateTag(ctx context.Context, tag, comment, hash string) (Tag, error) {
+	res, err := ir.invoke(ctx, "CreateTag", []interface{}{tag, comment, hash}, func(ctx context.Context, args []interface{}) (interface{}, error) {
+		return ir.wrapTag(ir.r.CreateTag(ctx, args[0].(string), args[1].(string), args[2].(string)))
+	})
+	t, _ := res.(Tag)
+	return t, err
+}
+
+func (ir *interceptedRepository) DeleteLocalTag(ctx context.Context, tag string) error {
+	return ir.invokeErr(ctx, "DeleteLocalTag", []interface{}{tag}, func(ctx context.Context, args []interface{}) error {
+		return ir.r.DeleteLocalTag(ctx, args[0].(string))
+	})
+}
+
+func (ir *interceptedRepository) DeleteTag(ctx context.Context, tag string) error {
+	return ir.invokeErr(ctx, "DeleteTag", []interface{}{tag}, func(ctx context.Context, args []interface{}) error {
+		return ir.r.DeleteTag(ctx, args[0].(string))
+	})
+}
+
+func (ir *interceptedRepository) Fetch(ctx context.Context, remote string) (*SyncResult, error) {
+	res, err := ir.invoke(ctx, "Fetch", []interface{}{remote}, func(ctx context.Context, args []interface{}) (interface{}, error) {
+		return ir.r.Fetch(ctx, args[0].(string))
+	})
+	sr, _ := res.(*SyncResult)
+	return sr, err
+}
+
+func (ir *interceptedRepository) FetchWithOptions(ctx context.Context, opts FetchOptions) (*SyncResult, error) {
+	res, err := ir.invoke(ctx, "FetchWithOptions", []interface{}{opts}, func(ctx context.Context, args []interface{}) (interface{}, error) {
+		return ir.r.FetchWithOptions(ctx, args[0].(FetchOptions))
+	})
+	sr, _ := res.(*SyncResult)
+	return sr, err
+}
+
+func (ir *interceptedRepository) Remotes(ctx context.Context) ([]Remote, error) {
+	res, err := ir.invoke(ctx, "Remotes", nil, func(ctx context.Context, _ []interface{}) (interface{}, error) {
+		return ir.r.Remotes(ctx)
+	})
+	remotes, _ := res.([]Remote)
+	return remotes, err
+}
+
+func (ir *interceptedRepository) AddRemote(ctx context.Context, name string, urls ...string) error {
+	return ir.invokeErr(ctx, "AddRemote", []interface{}{name, urls}, func(ctx context.Context, args []interface{}) error {
+		return ir.r.AddRemote(ctx, args[0].(string), args[1].([]string)...)
+	})
+}
+
+func (ir *interceptedRepository) RemoveRemote(ctx context.Context, name string) error {
+	return ir.invokeErr(ctx, "RemoveRemote", []interface{}{name}, func(ctx context.Context, args []interface{}) error {
+		return ir.r.RemoveRemote(ctx, args[0].(string))
+	})
+}
+
+func (ir *interceptedRepository) SetRemoteURL(ctx context.Context, name string, urls ...string) error {
+	return ir.invokeErr(ctx, "SetRemoteURL", []interface{}{name, urls}, func(ctx context.Context, args []interface{}) error {
+		return ir.r.SetRemoteURL(ctx, args[0].(string), args[1].([]string)...)
+	})
+}
+
+func (ir *interceptedRepository) Submodules(ctx context.Context) ([]Submodule, error) {
+	res, err := ir.invoke(ctx, "Submodules", nil, func(ctx context.Context, _ []interface{}) (interface{}, error) {
+		return ir.r.Submodules(ctx)
+	})
+	submodules, _ := res.([]Submodule)
+	return submodules, err
+}
+
+func (ir *interceptedRepository) UpdateSubmodules(ctx context.Context, opts SubmoduleUpdateOptions) error {
+	return ir.invokeErr(ctx, "UpdateSubmodules", []interface{}{opts}, func(ctx context.Context, args []interface{}) error {
+		return ir.r.UpdateSubmodules(ctx, args[0].(SubmoduleUpdateOptions))
+	})
+}
+
+func (ir *interceptedRepository) LFSFiles(ctx context.Context) ([]LFSFile, error) {
+	res, err := ir.invoke(ctx, "LFSFiles", nil, func(ctx context.Context, _ []interface{}) (interface{}, error) {
+		return ir.r.LFSFiles(ctx)
+	})
+	files, _ := res.([]LFSFile)
+	return files, err
+}
+
+func (ir *interceptedRepository) LFSPull(ctx context.Context) error {
+	return ir.invokeErr(ctx, "LFSPull", nil, func(ctx context.Context, _ []interface{}) error {
+		return ir.r.LFSPull(ctx)
+	})
+}
+
+func (ir *interceptedRepository) MirrorSync(ctx context.Context) error {
+	return ir.invokeErr(ctx, "MirrorSync", nil, func(ctx context.Context, _ []interface{}) error {
+		return ir.r.MirrorSync(ctx)
+	})
+}
+
+func (ir *interceptedRepository) Verify(ctx context.Context, rev string) error {
+	return ir.invokeErr(ctx, "Verify", []interface{}{rev}, func(ctx context.Context, args []interface{}) error {
+		return ir.r.Verify(ctx, args[0].(string))
+	})
+}
+
+// wrapBranch Branch的Delete以及Push也经过拦截器
+func (ir *interceptedRepository) wrapBranch(b Branch, err error) (interface{}, error) {
+	if b == nil {
+		return nil, err
+	}
+	return &interceptedRef{r: ir, kind: "Branch", name: b.(*branch).Name, target: b}, err
+}
+
+// wrapTag Tag的Delete以及Push也经过拦截器
+func (ir *interceptedRepository) wrapTag(t Tag, err error) (interface{}, error) {
+	if t == nil {
+		return nil, err
+	}
+	return &interceptedRef{r: ir, kind: "Tag", name: t.(*tag).Name().Short(), target: t}, err
+}
+
+// interceptedRef 经过拦截器的Branch或者Tag，Args为分支或者标签名
+type interceptedRef struct {
+	r      *interceptedRepository
+	kind   string
+	name   string
+	target interface {
+		Delete(ctx context.Context) error
+		Push(ctx context.Context) error
+	}
+}
+
+func (ref *interceptedRef) Delete(ctx context.Context) error {
+	return ref.r.invokeErr(ctx, ref.kind+".Delete", []interface{}{ref.name}, func(ctx context.Context, _ []interface{}) error {
+		return ref.target.Delete(ctx)
+	})
+}
+
+func (ref *interceptedRef) Push(ctx context.Context) error {
+	return ref.r.invokeErr(ctx, ref.kind+".Push", []interface{}{ref.name}, func(ctx context.Context, _ []interface{}) error {
+		return ref.target.Push(ctx)
+	})
+}
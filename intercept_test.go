@@ -0,0 +1,97 @@
+package gittools
+
+import (
+	"context"
+	"errors"
+	git "github.com/go-git/go-git/v5"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestInterceptor(t *testing.T) {
+	Convey("interceptor", t, func() {
+		ctx := context.Background()
+		remote := newBareRemote(t)
+		_, upstream := newLocalRepository(t)
+		So(upstream.AddRemote(ctx, DefaultRemoteName, remote), ShouldBeNil)
+		_, err := upstream.Push(ctx, "")
+		So(err, ShouldBeNil)
+
+		var ops []string
+		errProtected := errors.New("push to master is not allowed")
+		audit := func(ctx context.Context, op *Operation, next Handler) error {
+			ops = append(ops, op.Name)
+			return next(ctx, op)
+		}
+		protect := func(ctx context.Context, op *Operation, next Handler) error {
+			switch op.Name {
+			case "Push", "PushWithOptions":
+				if op.Ref == "refs/heads/master" {
+					return errProtected
+				}
+			case "Branch.Push":
+				if op.Args[0] == "master" {
+					return errProtected
+				}
+			case "Commit":
+				op.Args[0] = "[bot] " + op.Args[0].(string)
+			}
+			return next(ctx, op)
+		}
+		g := New(WithUserName("botman"), WithUserEmail("botman@sandwich.com"), WithInterceptor(audit, protect))
+		r, err := g.Clone(ctx, remote, "")
+		So(err, ShouldBeNil)
+		defer func() { _ = r.RemoveAll() }()
+
+		Convey("audit and modify args", func() {
+			So(r.RewriteFile(ctx, "a.txt", []byte("a")), ShouldBeNil)
+			So(r.Commit(ctx, "a"), ShouldBeNil)
+			So(ops, ShouldResemble, []string{"Clone", "RewriteFile", "Commit"})
+			repo, err := git.PlainOpen(r.Root())
+			So(err, ShouldBeNil)
+			head, err := repo.Head()
+			So(err, ShouldBeNil)
+			c, err := repo.CommitObject(head.Hash())
+			So(err, ShouldBeNil)
+			So(c.Message, ShouldEqual, "[bot] a")
+		})
+
+		Convey("veto", func() {
+			So(r.RewriteFile(ctx, "a.txt", []byte("a")), ShouldBeNil)
+			So(r.Commit(ctx, "a"), ShouldBeNil)
+			_, err := r.Push(ctx, "")
+			So(err, ShouldEqual, errProtected)
+			b, err := r.Branch(ctx, "master")
+			So(err, ShouldBeNil)
+			So(b.Push(ctx), ShouldEqual, errProtected)
+
+			_, err = r.PushWithOptions(ctx, PushOptions{RefSpecs: []string{"refs/heads/master:refs/heads/feature"}})
+			So(err, ShouldEqual, errProtected)
+			So(ops, ShouldResemble, []string{"Clone", "RewriteFile", "Commit", "Push", "Branch", "Branch.Push", "PushWithOptions"})
+		})
+
+		Convey("result", func() {
+			g.ApplyOption(WithInterceptor(func(ctx context.Context, op *Operation, next Handler) error {
+				err := next(ctx, op)
+				if op.Name == "Remotes" {
+					op.Result = []Remote(nil)
+				}
+				return err
+			}))
+			remotes, err := r.Remotes(ctx)
+			So(err, ShouldBeNil)
+			So(remotes, ShouldBeEmpty)
+		})
+
+		Convey("skip next without result", func() {
+			g.ApplyOption(WithInterceptor(func(ctx context.Context, op *Operation, next Handler) error {
+				return nil
+			}))
+			_, err := r.Remotes(ctx)
+			So(err, ShouldEqual, ErrOperationVetoed)
+			_, err = g.Clone(ctx, remote, "")
+			So(err, ShouldEqual, ErrOperationVetoed)
+			So(r.Commit(ctx, "a"), ShouldBeNil)
+		})
+	})
+}
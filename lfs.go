@@ -0,0 +1,662 @@
+package gittools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/memfs"
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	formatcfg "github.com/go-git/go-git/v5/plumbing/format/config"
+	"github.com/go-git/go-git/v5/plumbing/format/gitattributes"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	lfsSpec       = "https://git-lfs.github.com/spec/v1"
+	lfsLegacySpec = "https://hawser.github.com/spec/v1"
+	// lfsPointerMaxSize git-lfs规定pointer文件不超过1024字节
+	lfsPointerMaxSize = 1024
+	lfsConfigFile     = ".lfsconfig"
+)
+
+var (
+	// ErrNotLFSPointer 内容不是LFS pointer
+	ErrNotLFSPointer = errors.New("not a lfs pointer")
+	// ErrLFSEndpointNotFound 无法从remote的地址推断LFS服务地址
+	ErrLFSEndpointNotFound = errors.New("lfs endpoint not found")
+	// ErrLFSObjectMismatch 下载的LFS对象与pointer不一致
+	ErrLFSObjectMismatch = errors.New("lfs object mismatch")
+)
+
+// LFSPointer git lfs的pointer文件
+type LFSPointer struct {
+	// OID 对象内容的sha256
+	OID string
+	// Size 对象内容的大小
+	Size int64
+}
+
+// LFSFile 工作区中被LFS管理的文件
+type LFSFile struct {
+	LFSPointer
+	// Path 相对于根目录的路径
+	Path string
+	// Downloaded 工作区中是否已是实际内容，为false表示工作区中仍是pointer文件
+	Downloaded bool
+}
+
+// ParseLFSPointer 解析LFS pointer文件
+func ParseLFSPointer(data []byte) (*LFSPointer, error) {
+	if len(data) > lfsPointerMaxSize {
+		return nil, ErrNotLFSPointer
+	}
+	p := &LFSPointer{Size: -1}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for i := 0; scanner.Scan(); i++ {
+		kv := strings.SplitN(scanner.Text(), " ", 2)
+		if len(kv) != 2 {
+			return nil, ErrNotLFSPointer
+		}
+		switch {
+		case i == 0:
+			if kv[0] != "version" || (kv[1] != lfsSpec && kv[1] != lfsLegacySpec) {
+				return nil, ErrNotLFSPointer
+			}
+		case kv[0] == "oid":
+			oid := strings.TrimPrefix(kv[1], "sha256:")
+			if _, err := hex.DecodeString(oid); err != nil || len(oid) != sha256.Size*2 || oid == kv[1] {
+				return nil, ErrNotLFSPointer
+			}
+			p.OID = oid
+		case kv[0] == "size":
+			size, err := strconv.ParseInt(kv[1], 10, 64)
+			if err != nil || size < 0 {
+				return nil, ErrNotLFSPointer
+			}
+			p.Size = size
+		}
+	}
+	if len(p.OID) == 0 || p.Size < 0 {
+		return nil, ErrNotLFSPointer
+	}
+	return p, nil
+}
+
+// NewLFSPointer 根据内容计算LFS pointer
+func NewLFSPointer(r io.Reader) (*LFSPointer, error) {
+	h := sha256.New()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return nil, err
+	}
+	return &LFSPointer{OID: hex.EncodeToString(h.Sum(nil)), Size: n}, nil
+}
+
+// Bytes pointer文件的内容
+func (p LFSPointer) Bytes() []byte {
+	return []byte(fmt.Sprintf("version %s\noid sha256:%s\nsize %d\n", lfsSpec, p.OID, p.Size))
+}
+
+func (p LFSPointer) objectPath() string {
+	return path.Join("objects", p.OID[0:2], p.OID[2:4], p.OID)
+}
+
+// lfsMatcher 根据工作区中的.gitattributes判断文件是否被LFS管理，没有被LFS管理的文件时返回nil
+func (r *repository) lfsMatcher() (func(name string) bool, error) {
+	workTree, err := r.Worktree()
+	if err != nil {
+		// bare仓库没有工作区
+		return nil, nil
+	}
+	var attrs []gitattributes.MatchAttribute
+	if attrs, err = gitattributes.ReadPatterns(workTree.Filesystem, nil); err != nil {
+		return nil, err
+	}
+	var found bool
+	for _, a := range attrs {
+		for _, v := range a.Attributes {
+			if v.Name() == "filter" && v.IsValueSet() && v.Value() == "lfs" {
+				found = true
+			}
+		}
+	}
+	if !found {
+		return nil, nil
+	}
+	m := gitattributes.NewMatcher(attrs)
+	return func(name string) bool {
+		results, _ := m.Match(strings.Split(name, "/"), []string{"filter"})
+		a, ok := results["filter"]
+		return ok && a.IsValueSet() && a.Value() == "lfs"
+	}, nil
+}
+
+// lfsEndpoint LFS服务地址，依次使用LFSURL、git config lfs.url、.lfsconfig，最后根据origin的url推导
+func (r *repository) lfsEndpoint() (string, error) {
+	if u := r.h.GetLFSURL(); len(u) > 0 {
+		return u, nil
+	}
+	c, err := r.Config()
+	if err != nil {
+		return "", err
+	}
+	if u := c.Raw.Section("lfs").Option("url"); len(u) > 0 {
+		return u, nil
+	}
+	if workTree, err0 := r.Worktree(); err0 == nil {
+		if f, err0 := workTree.Filesystem.Open(lfsConfigFile); err0 == nil {
+			lc := formatcfg.New()
+			err0 = formatcfg.NewDecoder(f).Decode(lc)
+			_ = f.Close()
+			if u := lc.Section("lfs").Option("url"); err0 == nil && len(u) > 0 {
+				return u, nil
+			}
+		}
+	}
+	rc, ok := c.Remotes[DefaultRemoteName]
+	if !ok || len(rc.URLs) == 0 {
+		return "", ErrRemoteNotFound
+	}
+	var ep *transport.Endpoint
+	if ep, err = transport.NewEndpoint(rc.URLs[0]); err != nil {
+		return "", err
+	}
+	var u string
+	switch ep.Protocol {
+	case "http", "https":
+		u = ep.String()
+	case "ssh":
+		u = fmt.Sprintf("https://%s/%s", ep.Host, strings.TrimPrefix(ep.Path, "/"))
+	default:
+		return "", fmt.Errorf("%w, url: %s", ErrLFSEndpointNotFound, redactURL(rc.URLs[0]))
+	}
+	if !strings.HasSuffix(u, ".git") {
+		u += ".git"
+	}
+	return u + "/info/lfs", nil
+}
+
+// lfsStorage 本地LFS对象的存储，与git-lfs一致位于.git/lfs，内存中的Repository则存储在内存中
+func (r *repository) lfsStorage() (billy.Filesystem, error) {
+	if r.lfs == nil {
+		if fs, ok := r.Storer.(interface{ Filesystem() billy.Filesystem }); ok {
+			var err error
+			if r.lfs, err = fs.Filesystem().Chroot("lfs"); err != nil {
+				return nil, err
+			}
+		} else {
+			r.lfs = memfs.New()
+		}
+	}
+	return r.lfs, nil
+}
+
+func (r *repository) hasLFSObject(p LFSPointer) bool {
+	fs, err := r.lfsStorage()
+	if err != nil {
+		return false
+	}
+	fi, err := fs.Stat(p.objectPath())
+	return err == nil && fi.Size() == p.Size
+}
+
+func (r *repository) openLFSObject(p LFSPointer) (billy.File, error) {
+	fs, err := r.lfsStorage()
+	if err != nil {
+		return nil, err
+	}
+	return fs.Open(p.objectPath())
+}
+
+// writeLFSObject 将内容写入本地LFS存储，expected不为nil时校验内容
+func (r *repository) writeLFSObject(expected *LFSPointer, rd io.Reader) (p *LFSPointer, err error) {
+	var fs billy.Filesystem
+	if fs, err = r.lfsStorage(); err != nil {
+		return
+	}
+	if err = fs.MkdirAll("tmp", 0755); err != nil {
+		return
+	}
+	var tmp billy.File
+	if tmp, err = fs.TempFile("tmp", "object"); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			_ = fs.Remove(tmp.Name())
+		}
+	}()
+	p, err = NewLFSPointer(io.TeeReader(rd, tmp))
+	if err0 := tmp.Close(); err == nil {
+		err = err0
+	}
+	if err != nil {
+		return
+	}
+	if expected != nil && *expected != *p {
+		return nil, fmt.Errorf("%w, want: %s, got: %s, size: %d", ErrLFSObjectMismatch, expected.OID, p.OID, p.Size)
+	}
+	if err = fs.MkdirAll(path.Dir(p.objectPath()), 0755); err != nil {
+		return
+	}
+	err = fs.Rename(tmp.Name(), p.objectPath())
+	return
+}
+
+// blobPointer 若blob是LFS pointer，返回pointer，否则返回nil
+func (r *repository) blobPointer(hash plumbing.Hash) (*LFSPointer, error) {
+	obj, err := r.Storer.EncodedObject(plumbing.BlobObject, hash)
+	if err != nil {
+		return nil, err
+	}
+	if obj.Size() > lfsPointerMaxSize {
+		return nil, nil
+	}
+	var rd io.ReadCloser
+	if rd, err = obj.Reader(); err != nil {
+		return nil, err
+	}
+	defer func() { _ = rd.Close() }()
+	var data []byte
+	if data, err = io.ReadAll(rd); err != nil {
+		return nil, err
+	}
+	p, err := ParseLFSPointer(data)
+	if err == ErrNotLFSPointer {
+		return nil, nil
+	}
+	return p, err
+}
+
+// cleanLFS 将index中被LFS管理但不是pointer的文件替换为pointer，内容写入本地LFS存储，等同于git-lfs的clean filter，未开启LFS时不处理
+func (r *repository) cleanLFS() error {
+	if !r.h.GetLFS() {
+		return nil
+	}
+	match, err := r.lfsMatcher()
+	if err != nil || match == nil {
+		return err
+	}
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return err
+	}
+	var changed bool
+	for _, e := range idx.Entries {
+		if !e.Mode.IsFile() || !match(e.Name) {
+			continue
+		}
+		var p *LFSPointer
+		if p, err = r.blobPointer(e.Hash); err != nil {
+			return err
+		} else if p != nil {
+			continue
+		}
+		var obj plumbing.EncodedObject
+		if obj, err = r.Storer.EncodedObject(plumbing.BlobObject, e.Hash); err != nil {
+			return err
+		}
+		var rd io.ReadCloser
+		if rd, err = obj.Reader(); err != nil {
+			return err
+		}
+		p, err = r.writeLFSObject(nil, rd)
+		_ = rd.Close()
+		if err != nil {
+			return err
+		}
+		if e.Hash, err = r.storeObject(func(o plumbing.EncodedObject) error {
+			o.SetType(plumbing.BlobObject)
+			w, err0 := o.Writer()
+			if err0 != nil {
+				return err0
+			}
+			if _, err0 = w.Write(p.Bytes()); err0 != nil {
+				return err0
+			}
+			return w.Close()
+		}); err != nil {
+			return err
+		}
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return r.Storer.SetIndex(idx)
+}
+
+// lfsStatus 工作区中已下载的LFS文件与index中的pointer一致时，不认为是修改
+func (r *repository) lfsStatus(workTree *git.Worktree, status git.Status) error {
+	match, err := r.lfsMatcher()
+	if err != nil || match == nil {
+		return err
+	}
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return err
+	}
+	for k, v := range status {
+		if v.Worktree != git.Modified || !match(k) {
+			continue
+		}
+		e, err0 := idx.Entry(k)
+		if err0 != nil {
+			continue
+		}
+		var f billy.File
+		if f, err = workTree.Filesystem.Open(k); err != nil {
+			return err
+		}
+		p, err0 := NewLFSPointer(f)
+		_ = f.Close()
+		if err0 != nil {
+			return err0
+		}
+		if plumbing.ComputeHash(plumbing.BlobObject, p.Bytes()) != e.Hash {
+			continue
+		}
+		if v.Worktree = git.Unmodified; v.Staging == git.Unmodified {
+			delete(status, k)
+		}
+	}
+	return nil
+}
+
+// readHead 读取文件开头的n个字节
+func readHead(fs billy.Filesystem, name string, n int64) ([]byte, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	return io.ReadAll(io.LimitReader(f, n))
+}
+
+func (r *repository) lfsFiles(ctx context.Context) ([]LFSFile, error) {
+	match, err := r.lfsMatcher()
+	if err != nil || match == nil {
+		return nil, err
+	}
+	var workTree *git.Worktree
+	if workTree, err = r.Worktree(); err != nil {
+		return nil, err
+	}
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+	var files []LFSFile
+	for _, e := range idx.Entries {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		if !e.Mode.IsFile() || !match(e.Name) || !r.inSparsePaths(e.Name) {
+			continue
+		}
+		var p *LFSPointer
+		if p, err = r.blobPointer(e.Hash); err != nil {
+			return nil, err
+		} else if p == nil {
+			continue
+		}
+		f := LFSFile{LFSPointer: *p, Path: e.Name}
+		if data, err0 := readHead(workTree.Filesystem, e.Name, lfsPointerMaxSize+1); err0 == nil {
+			_, err0 = ParseLFSPointer(data)
+			f.Downloaded = err0 == ErrNotLFSPointer
+		}
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+// lfsDownloaded 工作区中是否有已下载的LFS文件
+func (r *repository) lfsDownloaded(ctx context.Context) (bool, error) {
+	files, err := r.lfsFiles(ctx)
+	for _, f := range files {
+		if f.Downloaded {
+			return true, nil
+		}
+	}
+	return false, err
+}
+
+func (r *repository) LFSFiles(ctx context.Context) (files []LFSFile, err error) {
+	defer r.lock()()
+	defer r.bind(ctx)()
+	defer func(start time.Time) { r.done(start, &err, "lfs files") }(time.Now())
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	return r.lfsFiles(ctx)
+}
+
+// downloadLFS 下载本地LFS存储中不存在的对象
+func (r *repository) downloadLFS(ctx context.Context, pointers []LFSPointer) error {
+	var missing []LFSPointer
+	seen := make(map[string]struct{})
+	for _, p := range pointers {
+		if _, ok := seen[p.OID]; ok || r.hasLFSObject(p) {
+			continue
+		}
+		seen[p.OID] = struct{}{}
+		missing = append(missing, p)
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	endpoint, err := r.lfsEndpoint()
+	if err != nil {
+		return err
+	}
+	c := newLFSClient(endpoint)
+	var objs []lfsObject
+	if err = r.h.retry(ctx, "lfs batch", func() (err0 error) {
+		objs, err0 = c.batch(ctx, lfsOperationDownload, missing)
+		return
+	}); err != nil {
+		return err
+	}
+	var transferred int64
+	for i, o := range objs {
+		a, ok := o.Actions[lfsOperationDownload]
+		if !ok {
+			return fmt.Errorf("lfs object %s has no download action", o.OID)
+		}
+		p := LFSPointer{OID: o.OID, Size: o.Size}
+		if err = r.h.retry(ctx, "lfs download", func() error {
+			rd, err0 := c.download(ctx, a)
+			if err0 != nil {
+				return err0
+			}
+			defer func() { _ = rd.Close() }()
+			_, err0 = r.writeLFSObject(&p, rd)
+			return err0
+		}); err != nil {
+			return err
+		}
+		transferred += o.Size
+		r.h.notify(ctx, ProgressEvent{Op: "lfs download", Phase: "Downloading LFS objects", Current: int64(i + 1), Total: int64(len(objs)), Bytes: transferred, Done: i == len(objs)-1})
+	}
+	r.h.addBytes("lfs download", transferred)
+	return nil
+}
+
+// lfsPull 下载工作区中仍是pointer的文件，并替换为实际内容，等同于git lfs pull
+func (r *repository) lfsPull(ctx context.Context) error {
+	files, err := r.lfsFiles(ctx)
+	if err != nil || len(files) == 0 {
+		return err
+	}
+	var pointers []LFSPointer
+	for _, f := range files {
+		if !f.Downloaded {
+			pointers = append(pointers, f.LFSPointer)
+		}
+	}
+	if err = r.downloadLFS(ctx, pointers); err != nil {
+		return err
+	}
+	var workTree *git.Worktree
+	if workTree, err = r.Worktree(); err != nil {
+		return err
+	}
+	for _, f := range files {
+		if f.Downloaded {
+			continue
+		}
+		if err = r.smudgeLFS(workTree, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *repository) smudgeLFS(workTree *git.Worktree, f LFSFile) error {
+	src, err := r.openLFSObject(f.LFSPointer)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = src.Close() }()
+	var dst billy.File
+	if dst, err = workTree.Filesystem.OpenFile(f.Path, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0666); err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	if err0 := dst.Close(); err == nil {
+		err = err0
+	}
+	return err
+}
+
+func (r *repository) LFSPull(ctx context.Context) (err error) {
+	defer r.lock()()
+	defer func(start time.Time) { r.done(start, &err, "lfs pull") }(time.Now())
+	defer r.acquire(ctx, &err)()
+	if err != nil {
+		return
+	}
+	ctx, cancel := withTimeout(ctx, r.h.GetFetchTimeout())
+	defer cancel()
+	return r.lfsPull(ctx)
+}
+
+// peelCommit hash对应的commit，若是annotated tag则返回其指向的commit
+func (r *repository) peelCommit(hash plumbing.Hash) (*object.Commit, error) {
+	obj, err := r.Object(plumbing.AnyObject, hash)
+	if err != nil {
+		return nil, err
+	}
+	switch o := obj.(type) {
+	case *object.Commit:
+		return o, nil
+	case *object.Tag:
+		return o.Commit()
+	}
+	return nil, plumbing.ErrInvalidType
+}
+
+// uploadLFS 上传推送的ref对应commit中引用的、本地存在的LFS对象，等同于git-lfs的pre-push，未开启LFS时不上传
+func (r *repository) uploadLFS(ctx context.Context, updates []RefUpdate) error {
+	if !r.h.GetLFS() {
+		return nil
+	}
+	match, err := r.lfsMatcher()
+	if err != nil || match == nil {
+		return err
+	}
+	var pointers []LFSPointer
+	seen := make(map[string]struct{})
+	for _, u := range updates {
+		if len(u.New) == 0 || u.Status == RefStatusUpToDate || u.Status == RefStatusRejected {
+			continue
+		}
+		var c *object.Commit
+		if c, err = r.peelCommit(plumbing.NewHash(u.New)); err != nil {
+			return err
+		}
+		var tree *object.Tree
+		if tree, err = c.Tree(); err != nil {
+			return err
+		}
+		walker := object.NewTreeWalker(tree, true, nil)
+		for {
+			name, entry, err0 := walker.Next()
+			if err0 == io.EOF {
+				break
+			} else if err0 != nil {
+				walker.Close()
+				return err0
+			}
+			if !entry.Mode.IsFile() || !match(name) {
+				continue
+			}
+			p, err0 := r.blobPointer(entry.Hash)
+			if err0 != nil {
+				walker.Close()
+				return err0
+			}
+			// 未转换为pointer的文件(如超过pointer大小上限)直接作为普通blob推送
+			if p == nil {
+				continue
+			}
+			if _, ok := seen[p.OID]; ok || !r.hasLFSObject(*p) {
+				continue
+			}
+			seen[p.OID] = struct{}{}
+			pointers = append(pointers, *p)
+		}
+		walker.Close()
+	}
+	if len(pointers) == 0 {
+		return nil
+	}
+	endpoint, err := r.lfsEndpoint()
+	if err != nil {
+		return err
+	}
+	c := newLFSClient(endpoint)
+	var objs []lfsObject
+	if err = r.h.retry(ctx, "lfs batch", func() (err0 error) {
+		objs, err0 = c.batch(ctx, lfsOperationUpload, pointers)
+		return
+	}); err != nil {
+		return err
+	}
+	var transferred int64
+	for i, o := range objs {
+		// 服务端已存在的对象不会返回upload动作
+		if _, ok := o.Actions[lfsOperationUpload]; ok {
+			o := o
+			if err = r.h.retry(ctx, "lfs upload", func() error {
+				f, err0 := r.openLFSObject(LFSPointer{OID: o.OID, Size: o.Size})
+				if err0 != nil {
+					return err0
+				}
+				defer func() { _ = f.Close() }()
+				return c.upload(ctx, o, f)
+			}); err != nil {
+				return err
+			}
+			transferred += o.Size
+		}
+		r.h.notify(ctx, ProgressEvent{Op: "lfs upload", Phase: "Uploading LFS objects", Current: int64(i + 1), Total: int64(len(objs)), Bytes: transferred, Done: i == len(objs)-1})
+	}
+	r.h.addBytes("lfs upload", transferred)
+	return nil
+}
@@ -0,0 +1,202 @@
+package gittools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	. "github.com/smartystreets/goconvey/convey"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newLFSServer 内存中的LFS batch服务
+func newLFSServer(t *testing.T) (*httptest.Server, map[string][]byte) {
+	var mu sync.Mutex
+	objects := make(map[string][]byte)
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		oid := strings.TrimPrefix(req.URL.Path, "/objects/")
+		switch {
+		case req.URL.Path == "/objects/batch":
+			var in lfsBatchRequest
+			if err := json.NewDecoder(req.Body).Decode(&in); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			out := lfsBatchResponse{Transfer: "basic"}
+			for _, o := range in.Objects {
+				_, exists := objects[o.OID]
+				if in.Operation == lfsOperationUpload && exists {
+					out.Objects = append(out.Objects, lfsObject{OID: o.OID, Size: o.Size})
+					continue
+				}
+				if in.Operation == lfsOperationDownload && !exists {
+					out.Objects = append(out.Objects, lfsObject{OID: o.OID, Size: o.Size, Error: &lfsObjectError{Code: 404, Message: "not found"}})
+					continue
+				}
+				out.Objects = append(out.Objects, lfsObject{OID: o.OID, Size: o.Size, Actions: map[string]lfsAction{
+					in.Operation: {Href: srv.URL + "/objects/" + o.OID},
+				}})
+			}
+			w.Header().Set("Content-Type", lfsMediaType)
+			_ = json.NewEncoder(w).Encode(out)
+		case req.Method == http.MethodPut:
+			objects[oid], _ = io.ReadAll(req.Body)
+		case req.Method == http.MethodGet:
+			_, _ = w.Write(objects[oid])
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, objects
+}
+
+func TestLFS(t *testing.T) {
+	Convey("lfs", t, func() {
+		ctx := context.Background()
+		srv, objects := newLFSServer(t)
+		content := bytes.Repeat([]byte("lfs content\n"), 200)
+		p, err := NewLFSPointer(bytes.NewReader(content))
+		So(err, ShouldBeNil)
+
+		g, upstream := newLocalRepository(t, WithLFSURL(srv.URL), WithLFS(true))
+		So(upstream.RewriteFile(ctx, ".gitattributes", []byte("*.bin filter=lfs diff=lfs merge=lfs -text\n")), ShouldBeNil)
+		So(upstream.RewriteFile(ctx, "data.bin", content), ShouldBeNil)
+		So(upstream.Commit(ctx, "add lfs"), ShouldBeNil)
+		clean, err := upstream.IsClean()
+		So(err, ShouldBeNil)
+		So(clean, ShouldBeTrue)
+		files, err := upstream.LFSFiles(ctx)
+		So(err, ShouldBeNil)
+		So(files, ShouldResemble, []LFSFile{{LFSPointer: *p, Path: "data.bin", Downloaded: true}})
+
+		bare := newBareRemote(t)
+		So(upstream.AddRemote(ctx, DefaultRemoteName, bare), ShouldBeNil)
+		_, err = upstream.Push(ctx, "")
+		So(err, ShouldBeNil)
+		So(objects[p.OID], ShouldResemble, content)
+
+		Convey("basic auth", func() {
+			var auth string
+			authSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				auth = req.Header.Get("Authorization")
+				_ = json.NewEncoder(w).Encode(lfsBatchResponse{})
+			}))
+			defer authSrv.Close()
+			c := newLFSClient(strings.Replace(authSrv.URL, "://", "://user:token@", 1))
+			_, err := c.batch(ctx, lfsOperationDownload, []LFSPointer{*p})
+			So(err, ShouldBeNil)
+			So(c.endpoint, ShouldEqual, authSrv.URL)
+			So(auth, ShouldEqual, "Basic dXNlcjp0b2tlbg==")
+		})
+
+		Convey("disabled", func() {
+			old := g.ApplyOption(WithLFS(false))
+			defer g.ApplyOption(old...)
+			raw := bytes.Repeat([]byte("raw\n"), 100)
+			So(upstream.RewriteFile(ctx, "raw.bin", raw), ShouldBeNil)
+			So(upstream.Commit(ctx, "raw"), ShouldBeNil)
+			_, err = upstream.Push(ctx, "")
+			So(err, ShouldBeNil)
+			head, err := upstream.(*repository).Head()
+			So(err, ShouldBeNil)
+			c, err := upstream.(*repository).CommitObject(head.Hash())
+			So(err, ShouldBeNil)
+			f, err := c.File("raw.bin")
+			So(err, ShouldBeNil)
+			data, err := f.Contents()
+			So(err, ShouldBeNil)
+			So(data, ShouldEqual, string(raw))
+			So(objects, ShouldHaveLength, 1)
+		})
+
+		Convey("object error", func() {
+			missing, err := NewLFSPointer(strings.NewReader("missing"))
+			So(err, ShouldBeNil)
+			_, err = newLFSClient(srv.URL).batch(ctx, lfsOperationDownload, []LFSPointer{*missing})
+			So(IsNotFound(err), ShouldBeTrue)
+		})
+
+		Convey("parse pointer", func() {
+			got, err := ParseLFSPointer(p.Bytes())
+			So(err, ShouldBeNil)
+			So(*got, ShouldResemble, *p)
+			_, err = ParseLFSPointer(content)
+			So(err, ShouldEqual, ErrNotLFSPointer)
+		})
+
+		Convey("pull on demand", func() {
+			old := g.ApplyOption(WithLFS(false))
+			r, err := g.Clone(ctx, bare, "")
+			g.ApplyOption(old...)
+			So(err, ShouldBeNil)
+			wt, err := r.(*repository).Worktree()
+			So(err, ShouldBeNil)
+			data, err := readHead(wt.Filesystem, "data.bin", int64(len(content)))
+			So(err, ShouldBeNil)
+			So(data, ShouldResemble, p.Bytes())
+			files, err := r.LFSFiles(ctx)
+			So(err, ShouldBeNil)
+			So(files, ShouldHaveLength, 1)
+			So(files[0].Downloaded, ShouldBeFalse)
+
+			var events []ProgressEvent
+			old = g.ApplyOption(WithProgress(func(e ProgressEvent) { events = append(events, e) }))
+			defer g.ApplyOption(old...)
+			So(r.LFSPull(ctx), ShouldBeNil)
+			So(events, ShouldResemble, []ProgressEvent{{Op: "lfs download", Phase: "Downloading LFS objects", Current: 1, Total: 1, Bytes: p.Size, Done: true}})
+			data, err = readHead(wt.Filesystem, "data.bin", int64(len(content)))
+			So(err, ShouldBeNil)
+			So(data, ShouldResemble, content)
+			clean, err := r.IsClean()
+			So(err, ShouldBeNil)
+			So(clean, ShouldBeTrue)
+		})
+
+		Convey("push raw blob matching lfs patterns", func() {
+			// 未经过LFS转换直接提交的文件不是pointer
+			wt, err := upstream.(*repository).Worktree()
+			So(err, ShouldBeNil)
+			f, err := wt.Filesystem.Create("big.bin")
+			So(err, ShouldBeNil)
+			_, err = f.Write(bytes.Repeat([]byte("x"), 4096))
+			So(err, ShouldBeNil)
+			So(f.Close(), ShouldBeNil)
+			_, err = wt.Add("big.bin")
+			So(err, ShouldBeNil)
+			_, err = wt.Commit("raw", &git.CommitOptions{Author: &object.Signature{Name: "botman", Email: "botman@sandwich.com"}})
+			So(err, ShouldBeNil)
+			So(upstream.AddRemote(ctx, "fork", newBareRemote(t)), ShouldBeNil)
+			updates, err := upstream.PushWithOptions(ctx, PushOptions{Remote: "fork", RefSpecs: []string{"refs/heads/master:refs/heads/master"}})
+			So(err, ShouldBeNil)
+			So(updates[0].Status, ShouldEqual, RefStatusCreated)
+		})
+
+		Convey("clone with lfs", func() {
+			r, err := g.Clone(ctx, bare, "")
+			So(err, ShouldBeNil)
+			files, err := r.LFSFiles(ctx)
+			So(err, ShouldBeNil)
+			So(files, ShouldHaveLength, 1)
+			So(files[0].Downloaded, ShouldBeTrue)
+			clean, err := r.IsClean()
+			So(err, ShouldBeNil)
+			So(clean, ShouldBeTrue)
+
+			So(r.RewriteFile(ctx, "data.bin", append(content, 'x')), ShouldBeNil)
+			So(r.Commit(ctx, "update lfs"), ShouldBeNil)
+			_, err = r.Push(ctx, "")
+			So(err, ShouldBeNil)
+			So(objects, ShouldHaveLength, 2)
+			// 已下载的LFS文件需要强制checkout
+			So(r.CheckoutBranch(ctx, "master", ""), ShouldBeNil)
+		})
+	})
+}
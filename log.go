@@ -0,0 +1,224 @@
+package gittools
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const logPrefix = "[git]"
+
+// Level 日志级别
+type Level int
+
+const (
+	// LevelDebug 调试信息
+	LevelDebug Level = iota
+	// LevelInfo 操作成功
+	LevelInfo
+	// LevelWarn 可恢复的错误，如网络操作重试
+	LevelWarn
+	// LevelError 操作失败
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// 常用的日志字段
+const (
+	// FieldOp 操作名称，如clone、checkout、push
+	FieldOp = "op"
+	// FieldURL 远端仓库地址，不包括凭证
+	FieldURL = "url"
+	// FieldRef Repository当前的ref
+	FieldRef = "ref"
+	// FieldHash Repository当前的commit hash
+	FieldHash = "hash"
+	// FieldDuration 操作耗时
+	FieldDuration = "duration"
+	// FieldError 操作失败的原因
+	FieldError = "error"
+)
+
+// Field 结构化日志的字段
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// StructuredLogger 结构化日志，可通过NewSlogLogger、NewSugaredLogger适配常用的日志库
+type StructuredLogger interface {
+	Log(level Level, msg string, fields ...Field)
+}
+
+// StructuredLoggerFunc 函数形式的StructuredLogger
+type StructuredLoggerFunc func(level Level, msg string, fields ...Field)
+
+func (f StructuredLoggerFunc) Log(level Level, msg string, fields ...Field) { f(level, msg, fields...) }
+
+// NewSlogLogger 将log/slog的Logger适配为StructuredLogger
+func NewSlogLogger(l *slog.Logger) StructuredLogger {
+	return StructuredLoggerFunc(func(level Level, msg string, fields ...Field) {
+		attrs := make([]slog.Attr, 0, len(fields))
+		for _, f := range fields {
+			attrs = append(attrs, slog.Any(f.Key, f.Value))
+		}
+		l.LogAttrs(context.Background(), slogLevel(level), msg, attrs...)
+	})
+}
+
+func slogLevel(level Level) slog.Level {
+	switch level {
+	case LevelDebug:
+		return slog.LevelDebug
+	case LevelWarn:
+		return slog.LevelWarn
+	case LevelError:
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
+
+// SugaredLogger zap.SugaredLogger风格的日志接口
+type SugaredLogger interface {
+	Debugw(msg string, keysAndValues ...interface{})
+	Infow(msg string, keysAndValues ...interface{})
+	Warnw(msg string, keysAndValues ...interface{})
+	Errorw(msg string, keysAndValues ...interface{})
+}
+
+// NewSugaredLogger 将zap.SugaredLogger等SugaredLogger适配为StructuredLogger
+func NewSugaredLogger(l SugaredLogger) StructuredLogger {
+	return StructuredLoggerFunc(func(level Level, msg string, fields ...Field) {
+		kvs := make([]interface{}, 0, 2*len(fields))
+		for _, f := range fields {
+			kvs = append(kvs, f.Key, f.Value)
+		}
+		switch level {
+		case LevelDebug:
+			l.Debugw(msg, kvs...)
+		case LevelWarn:
+			l.Warnw(msg, kvs...)
+		case LevelError:
+			l.Errorw(msg, kvs...)
+		default:
+			l.Infow(msg, kvs...)
+		}
+	})
+}
+
+// textLogger 以logfmt格式输出到Logger，例如:
+// 2022/10/25 19:07:05 [git] level=info msg=success op=checkout want=refs/heads/master ref=refs/heads/master hash=086e42373a2433101b52bf35ecf84e1df9445c3f duration=1.2ms
+type textLogger struct {
+	l Logger
+}
+
+func (t textLogger) Log(level Level, msg string, fields ...Field) {
+	var sb strings.Builder
+	sb.WriteString(logPrefix)
+	sb.WriteString(" level=")
+	sb.WriteString(level.String())
+	sb.WriteString(" msg=")
+	sb.WriteString(logfmtValue(msg))
+	for _, f := range fields {
+		sb.WriteByte(' ')
+		sb.WriteString(f.Key)
+		sb.WriteByte('=')
+		sb.WriteString(logfmtValue(fmt.Sprint(f.Value)))
+	}
+	t.l.Println(sb.String())
+}
+
+// logfmtValue 包含空格、引号或者等号的值需要加引号
+func logfmtValue(s string) string {
+	if len(s) == 0 || strings.ContainsAny(s, " \t\r\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// logger 优先使用StructuredLogger，否则以logfmt格式输出到Logger，均为nil时不输出
+func (h *cloner) logger() StructuredLogger {
+	if l := h.GetStructuredLogger(); l != nil {
+		return l
+	}
+	if l := h.GetLogger(); l != nil {
+		return textLogger{l: l}
+	}
+	return nil
+}
+
+// emit 输出level不低于LogLevel的日志
+func (h *cloner) emit(level Level, msg string, fields ...Field) {
+	if level < h.GetLogLevel() {
+		return
+	}
+	if l := h.logger(); l != nil {
+		l.Log(level, msg, fields...)
+	}
+}
+
+// log 输出op的结果并计入Metrics，成功为Info级别，失败为Error级别
+func (h *cloner) log(start time.Time, err error, op string, fields ...Field) {
+	h.observe(start, err, op)
+	fields = append(append([]Field{{FieldOp, op}}, fields...), Field{FieldDuration, time.Since(start)})
+	if err != nil {
+		h.emit(LevelError, "failed", append(fields, Field{FieldError, err})...)
+	} else {
+		h.emit(LevelInfo, "success", fields...)
+	}
+}
+
+// done 输出op的结果，并将err包装为*OpError，远端地址、根目录以及ref取自fields中的url、dir以及ref
+func (h *cloner) done(start time.Time, err *error, op string, fields ...Field) {
+	h.log(start, *err, op, fields...)
+	var root, url, ref string
+	for _, f := range fields {
+		switch f.Key {
+		case FieldURL:
+			url, _ = f.Value.(string)
+		case "dir":
+			root, _ = f.Value.(string)
+		case FieldRef:
+			ref, _ = f.Value.(string)
+		}
+	}
+	*err = wrapOpError(*err, op, root, url, ref)
+}
+
+// done 输出op的结果，附加Repository当前的ref、hash以及远端地址，并将err包装为*OpError
+// 远端地址为fields中remote对应的地址，未指定remote时为origin，没有该remote时不附加
+func (r *repository) done(start time.Time, err *error, op string, fields ...Field) {
+	remote := DefaultRemoteName
+	for _, f := range fields {
+		if f.Key == "remote" {
+			remote, _ = f.Value.(string)
+		}
+	}
+	var url string
+	if rm, err0 := r.Repository.Remote(remote); err0 == nil && len(rm.Config().URLs) > 0 {
+		url = redactURL(rm.Config().URLs[0])
+	}
+	ref := r.currentRefName.String()
+	fields = append(fields, Field{FieldRef, ref}, Field{FieldHash, r.headHash.String()})
+	if len(url) > 0 {
+		fields = append(fields, Field{FieldURL, url})
+	}
+	r.h.log(start, *err, op, fields...)
+	*err = wrapOpError(*err, op, r.root(), url, ref)
+}
@@ -0,0 +1,294 @@
+package gittools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics 操作的指标，op与日志中的op一致，可使用NewPrometheusMetrics
+type Metrics interface {
+	// ObserveOperation 操作完成时调用，成功时errType为空，否则为ErrorType的返回值
+	ObserveOperation(op string, d time.Duration, errType string)
+	// AddBytes clone、fetch、push以及LFS传输的字节数，git操作为传输层收发的packfile字节数(包括sideband数据)，LFS为对象的大小
+	// git操作的字节数需要先调用InstallMeteredTransports
+	AddBytes(op string, n int64)
+}
+
+// ErrorType 错误的分类，用于指标的label
+func ErrorType(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, ErrLockTimeout):
+		return "timeout"
+	case IsAuthError(err):
+		return "auth"
+	case IsNotFound(err):
+		return "not_found"
+	case IsConflict(err):
+		return "conflict"
+	case IsNetworkError(err):
+		return "network"
+	}
+	return "other"
+}
+
+// observe 将op的结果计入Metrics
+func (h *cloner) observe(start time.Time, err error, op string) {
+	if m := h.GetMetrics(); m != nil {
+		m.ObserveOperation(op, time.Since(start), ErrorType(err))
+	}
+}
+
+// addBytes 将op传输的字节数计入Metrics
+func (h *cloner) addBytes(op string, n int64) {
+	if m := h.GetMetrics(); m != nil && n > 0 {
+		m.AddBytes(op, n)
+	}
+}
+
+// InstallMeteredTransports 包装go-git当前注册的所有传输协议，使配置了Metrics的操作统计clone、fetch以及push收发的packfile字节数
+// 会修改全局的client.Protocols，未配置Metrics的操作不受影响，需要在使用go-git之前调用，并且在自定义的client.InstallProtocol之后调用
+// 之后通过client.InstallProtocol替换的协议不统计，重复调用不会重复包装
+func InstallMeteredTransports() {
+	for scheme, t := range client.Protocols {
+		if _, ok := t.(*meteredTransport); !ok {
+			client.InstallProtocol(scheme, &meteredTransport{Transport: t})
+		}
+	}
+}
+
+type transferKey struct{}
+
+// transfer 传输层字节数计入的Metrics以及op
+type transfer struct {
+	m  Metrics
+	op string
+}
+
+// metered 返回传输层统计op字节数的ctx，未设置Metrics时直接返回ctx
+func (h *cloner) metered(ctx context.Context, op string) context.Context {
+	m := h.GetMetrics()
+	if m == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, transferKey{}, transfer{m: m, op: op})
+}
+
+// meteredTransport 统计fetch收到以及push发送的packfile字节数
+type meteredTransport struct {
+	transport.Transport
+}
+
+func (t *meteredTransport) NewUploadPackSession(ep *transport.Endpoint, auth transport.AuthMethod) (transport.UploadPackSession, error) {
+	s, err := t.Transport.NewUploadPackSession(ep, auth)
+	if err != nil {
+		return nil, err
+	}
+	return &meteredUploadPackSession{UploadPackSession: s}, nil
+}
+
+func (t *meteredTransport) NewReceivePackSession(ep *transport.Endpoint, auth transport.AuthMethod) (transport.ReceivePackSession, error) {
+	s, err := t.Transport.NewReceivePackSession(ep, auth)
+	if err != nil {
+		return nil, err
+	}
+	return &meteredReceivePackSession{ReceivePackSession: s}, nil
+}
+
+type meteredUploadPackSession struct {
+	transport.UploadPackSession
+}
+
+func (s *meteredUploadPackSession) UploadPack(ctx context.Context, req *packp.UploadPackRequest) (*packp.UploadPackResponse, error) {
+	resp, err := s.UploadPackSession.UploadPack(ctx, req)
+	t, ok := ctx.Value(transferKey{}).(transfer)
+	if err != nil || !ok {
+		return resp, err
+	}
+	metered := packp.NewUploadPackResponseWithPackfile(req, &meteredReader{ReadCloser: resp, t: t})
+	metered.ShallowUpdate, metered.ServerResponse = resp.ShallowUpdate, resp.ServerResponse
+	return metered, nil
+}
+
+type meteredReceivePackSession struct {
+	transport.ReceivePackSession
+}
+
+func (s *meteredReceivePackSession) ReceivePack(ctx context.Context, req *packp.ReferenceUpdateRequest) (*packp.ReportStatus, error) {
+	if t, ok := ctx.Value(transferKey{}).(transfer); ok && req.Packfile != nil {
+		req.Packfile = &meteredReader{ReadCloser: req.Packfile, t: t}
+	}
+	return s.ReceivePackSession.ReceivePack(ctx, req)
+}
+
+// meteredReader 读取时将字节数计入Metrics
+type meteredReader struct {
+	io.ReadCloser
+	t transfer
+}
+
+func (r *meteredReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.t.m.AddBytes(r.t.op, int64(n))
+	}
+	return n, err
+}
+
+// DefaultDurationBuckets PrometheusMetrics耗时直方图默认的bucket，单位为秒
+var DefaultDurationBuckets = []float64{0.01, 0.05, 0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// PrometheusMetrics 以Prometheus text格式输出的Metrics，可直接作为/metrics的http.Handler
+// 指标包括<namespace>_operations_total、<namespace>_operation_errors_total、
+// <namespace>_operation_duration_seconds以及<namespace>_transferred_bytes_total
+type PrometheusMetrics struct {
+	namespace string
+	buckets   []float64
+	mu        sync.Mutex
+	ops       map[string]float64
+	errs      map[[2]string]float64
+	durations map[string]*histogram
+	bytes     map[string]float64
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// NewPrometheusMetrics 创建PrometheusMetrics，namespace为空时为gittools，buckets为空时为DefaultDurationBuckets
+func NewPrometheusMetrics(namespace string, buckets ...float64) *PrometheusMetrics {
+	if len(namespace) == 0 {
+		namespace = "gittools"
+	}
+	if len(buckets) == 0 {
+		buckets = DefaultDurationBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &PrometheusMetrics{
+		namespace: namespace,
+		buckets:   buckets,
+		ops:       make(map[string]float64),
+		errs:      make(map[[2]string]float64),
+		durations: make(map[string]*histogram),
+		bytes:     make(map[string]float64),
+	}
+}
+
+func (m *PrometheusMetrics) ObserveOperation(op string, d time.Duration, errType string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ops[op]++
+	if len(errType) > 0 {
+		m.errs[[2]string{op, errType}]++
+	}
+	hist, ok := m.durations[op]
+	if !ok {
+		hist = &histogram{counts: make([]uint64, len(m.buckets))}
+		m.durations[op] = hist
+	}
+	seconds := d.Seconds()
+	for i, b := range m.buckets {
+		if seconds <= b {
+			hist.counts[i]++
+		}
+	}
+	hist.sum += seconds
+	hist.count++
+}
+
+func (m *PrometheusMetrics) AddBytes(op string, n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bytes[op] += float64(n)
+}
+
+// WriteTo 以Prometheus text格式写出所有指标
+func (m *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var sb strings.Builder
+	name := m.namespace + "_operations_total"
+	fmt.Fprintf(&sb, "# HELP %s Number of git operations.\n# TYPE %s counter\n", name, name)
+	for _, op := range sortedKeys(m.ops) {
+		fmt.Fprintf(&sb, "%s{op=%s} %s\n", name, labelValue(op), formatFloat(m.ops[op]))
+	}
+	name = m.namespace + "_operation_errors_total"
+	fmt.Fprintf(&sb, "# HELP %s Number of failed git operations by error type.\n# TYPE %s counter\n", name, name)
+	errKeys := make([][2]string, 0, len(m.errs))
+	for k := range m.errs {
+		errKeys = append(errKeys, k)
+	}
+	sort.Slice(errKeys, func(i, j int) bool {
+		return errKeys[i][0] < errKeys[j][0] || errKeys[i][0] == errKeys[j][0] && errKeys[i][1] < errKeys[j][1]
+	})
+	for _, k := range errKeys {
+		fmt.Fprintf(&sb, "%s{op=%s,type=%s} %s\n", name, labelValue(k[0]), labelValue(k[1]), formatFloat(m.errs[k]))
+	}
+	name = m.namespace + "_operation_duration_seconds"
+	fmt.Fprintf(&sb, "# HELP %s Duration of git operations.\n# TYPE %s histogram\n", name, name)
+	ops := make([]string, 0, len(m.durations))
+	for op := range m.durations {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	for _, op := range ops {
+		hist := m.durations[op]
+		for i, b := range m.buckets {
+			fmt.Fprintf(&sb, "%s_bucket{op=%s,le=\"%s\"} %d\n", name, labelValue(op), formatFloat(b), hist.counts[i])
+		}
+		fmt.Fprintf(&sb, "%s_bucket{op=%s,le=\"+Inf\"} %d\n", name, labelValue(op), hist.count)
+		fmt.Fprintf(&sb, "%s_sum{op=%s} %s\n", name, labelValue(op), formatFloat(hist.sum))
+		fmt.Fprintf(&sb, "%s_count{op=%s} %d\n", name, labelValue(op), hist.count)
+	}
+	name = m.namespace + "_transferred_bytes_total"
+	fmt.Fprintf(&sb, "# HELP %s Bytes transferred by git operations.\n# TYPE %s counter\n", name, name)
+	for _, op := range sortedKeys(m.bytes) {
+		fmt.Fprintf(&sb, "%s{op=%s} %s\n", name, labelValue(op), formatFloat(m.bytes[op]))
+	}
+	n, err := io.WriteString(w, sb.String())
+	return int64(n), err
+}
+
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = m.WriteTo(w)
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// labelValue label的值需要转义反斜杠、双引号以及换行
+func labelValue(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,69 @@
+package gittools
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	Convey("metrics", t, func() {
+		Convey("error type", func() {
+			for err, typ := range map[error]string{
+				context.Canceled:                               "canceled",
+				fmt.Errorf("lock: %w", ErrLockTimeout):         "timeout",
+				transport.ErrAuthenticationRequired:            "auth",
+				fmt.Errorf("branch: %w", ErrReferenceNotFound): "not_found",
+				ErrNonFastForwardUpdate:                        "conflict",
+				fmt.Errorf("fetch: %w", syscall.ECONNRESET):    "network",
+				fmt.Errorf("something else"):                   "other",
+			} {
+				So(ErrorType(err), ShouldEqual, typ)
+			}
+			So(ErrorType(nil), ShouldBeEmpty)
+		})
+
+		Convey("prometheus", func() {
+			ctx := context.Background()
+			InstallMeteredTransports()
+			m := NewPrometheusMetrics("", 0.5, 1)
+			g, r := newLocalRepository(t, WithMetrics(m))
+			So(r.RewriteFile(ctx, "a.txt", []byte("a")), ShouldBeNil)
+			So(r.DeleteLocalBranch(ctx, "none"), ShouldNotBeNil)
+			So(r.Commit(ctx, "a"), ShouldBeNil)
+			So(r.AddRemote(ctx, DefaultRemoteName, newBareRemote(t)), ShouldBeNil)
+			_, err := r.Push(ctx, "")
+			So(err, ShouldBeNil)
+			c, err := g.Clone(ctx, r.Root(), "")
+			So(err, ShouldBeNil)
+			defer func() { _ = c.RemoveAll() }()
+			m.ObserveOperation("slow", 2*time.Second, "")
+
+			rec := httptest.NewRecorder()
+			m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+			out := rec.Body.String()
+			So(out, ShouldContainSubstring, `gittools_operations_total{op="rewrite file"} 2`)
+			So(out, ShouldContainSubstring, `gittools_operations_total{op="delete local branch"} 1`)
+			So(out, ShouldContainSubstring, `gittools_operation_errors_total{op="delete local branch",type="not_found"} 1`)
+			So(out, ShouldContainSubstring, `gittools_operation_duration_seconds_bucket{op="rewrite file",le="0.5"} 2`)
+			So(out, ShouldContainSubstring, `gittools_operation_duration_seconds_bucket{op="slow",le="1"} 0`)
+			So(out, ShouldContainSubstring, `gittools_operation_duration_seconds_bucket{op="slow",le="+Inf"} 1`)
+			So(out, ShouldContainSubstring, `gittools_operation_duration_seconds_sum{op="slow"} 2`)
+			// 传输层的字节数包括packfile以及sideband数据
+			So(m.bytes["clone"], ShouldBeGreaterThan, 0)
+			So(m.bytes["push"], ShouldBeGreaterThan, 0)
+			So(out, ShouldContainSubstring, fmt.Sprintf("gittools_transferred_bytes_total{op=\"clone\"} %s\n", formatFloat(m.bytes["clone"])))
+
+			var buf bytes.Buffer
+			_, err = m.WriteTo(&buf)
+			So(err, ShouldBeNil)
+			So(buf.String(), ShouldEqual, out)
+		})
+	})
+}
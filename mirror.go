@@ -0,0 +1,134 @@
+package gittools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"time"
+)
+
+// MirrorRemoteName MirrorSync时镜像推送的remote名称，可通过AddRemote添加
+const MirrorRemoteName = "mirror"
+
+// mirrorRefSpec 与git clone --mirror/git push --mirror一致，镜像所有ref
+const mirrorRefSpec = config.RefSpec("+refs/*:refs/*")
+
+// ErrNotMirror MirrorSync仅支持CloneMirror创建的bare mirror仓库
+var ErrNotMirror = errors.New("repository is not a bare mirror")
+
+// isMirror 是否是bare mirror仓库，即没有工作区，并且origin配置了mirror或者镜像所有ref的refspec
+// 有工作区时+refs/*:refs/*会强制覆盖本地分支，普通的bare仓库则会被覆盖并prune所有ref
+func (r *repository) isMirror() (bool, error) {
+	if _, err := r.Repository.Worktree(); err != ErrIsBareRepository {
+		return false, nil
+	}
+	c, err := r.Config()
+	if err != nil {
+		return false, err
+	}
+	rc, ok := c.Remotes[DefaultRemoteName]
+	if !ok {
+		return false, nil
+	}
+	if rc.Mirror {
+		return true, nil
+	}
+	for _, rs := range rc.Fetch {
+		if rs == mirrorRefSpec {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *repository) MirrorSync(ctx context.Context) (err error) {
+	defer r.lock()()
+	defer func(start time.Time) { r.done(start, &err, "mirror sync") }(time.Now())
+	var mirror bool
+	if mirror, err = r.isMirror(); err != nil {
+		return
+	} else if !mirror {
+		err = ErrNotMirror
+		return
+	}
+	defer r.acquire(ctx, &err)()
+	if err != nil {
+		return
+	}
+	if r.h.GetDryRun() {
+		err = r.dryRunMirrorSync()
+		return
+	}
+	var auth transport.AuthMethod
+	if auth, err = r.remoteAuth(DefaultRemoteName); err != nil {
+		return
+	}
+	fetchCtx, cancel := withTimeout(ctx, r.h.GetFetchTimeout())
+	defer cancel()
+	if err = checkErr(r.h.retry(fetchCtx, "mirror fetch", func() error {
+		return r.Repository.FetchContext(r.h.metered(fetchCtx, "mirror fetch"), &git.FetchOptions{
+			RemoteName: DefaultRemoteName,
+			RefSpecs:   []config.RefSpec{mirrorRefSpec},
+			Auth:       auth,
+			Progress:   r.h.progress(ctx, "mirror fetch"),
+			Tags:       git.AllTags,
+			Prune:      true,
+			Force:      true,
+		})
+	})); err != nil {
+		return
+	}
+	if _, err = r.Repository.Remote(MirrorRemoteName); err == ErrRemoteNotFound {
+		err = nil
+		return
+	} else if err != nil {
+		return
+	}
+	if auth, err = r.remoteAuth(MirrorRemoteName); err != nil {
+		return
+	}
+	pushCtx, cancel := withTimeout(ctx, r.h.GetPushTimeout())
+	defer cancel()
+	var specs []config.RefSpec
+	if specs, err = r.mirrorPushRefSpecs(pushCtx, auth); err != nil {
+		return
+	}
+	err = checkErr(r.h.retry(pushCtx, "mirror push", func() error {
+		return r.Repository.PushContext(r.h.metered(pushCtx, "mirror push"), &git.PushOptions{
+			RemoteName: MirrorRemoteName,
+			RefSpecs:   specs,
+			Auth:       auth,
+			Progress:   r.h.progress(ctx, "mirror push"),
+		})
+	}))
+	return
+}
+
+// mirrorPushRefSpecs 镜像推送的refspec，包含删除远端多余ref的refspec
+// go-git的Prune在refspec带有'+'时会误删远端所有ref，因此需要自行计算需要删除的ref
+func (r *repository) mirrorPushRefSpecs(ctx context.Context, auth transport.AuthMethod) ([]config.RefSpec, error) {
+	rm, err := r.Repository.Remote(MirrorRemoteName)
+	if err != nil {
+		return nil, err
+	}
+	var remoteRefs []*plumbing.Reference
+	if remoteRefs, err = r.listRemote(ctx, rm, auth); err != nil {
+		return nil, err
+	}
+	specs := []config.RefSpec{mirrorRefSpec}
+	for _, ref := range remoteRefs {
+		if ref.Type() != plumbing.HashReference || ref.Name() == plumbing.HEAD {
+			continue
+		}
+		if _, err = r.Storer.Reference(ref.Name()); err == plumbing.ErrReferenceNotFound {
+			specs = append(specs, config.RefSpec(fmt.Sprintf(":%s", ref.Name())))
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return specs, nil
+}
@@ -0,0 +1,59 @@
+package gittools
+
+import (
+	"context"
+	"errors"
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestMirror(t *testing.T) {
+	Convey("bare and mirror clone", t, func() {
+		ctx := context.Background()
+		g, upstream := newLocalRepository(t)
+		_, err := upstream.CreateBranch(ctx, "feature", "")
+		So(err, ShouldBeNil)
+
+		bare, err := g.CloneBare(ctx, upstream.Root(), "")
+		So(err, ShouldBeNil)
+		defer func() { _ = bare.RemoveAll() }()
+		So(bare.Root(), ShouldNotBeEmpty)
+		_, err = bare.IsClean()
+		So(errors.Is(err, ErrIsBareRepository), ShouldBeTrue)
+
+		mirror, err := g.CloneMirror(ctx, upstream.Root(), "")
+		So(err, ShouldBeNil)
+		defer func() { _ = mirror.RemoveAll() }()
+		secondary := newBareRemote(t)
+		So(mirror.AddRemote(ctx, MirrorRemoteName, secondary), ShouldBeNil)
+		So(mirror.MirrorSync(ctx), ShouldBeNil)
+		So(errors.Is(upstream.MirrorSync(ctx), ErrNotMirror), ShouldBeTrue)
+		So(errors.Is(bare.MirrorSync(ctx), ErrNotMirror), ShouldBeTrue)
+
+		So(upstream.RewriteFile(ctx, "b.txt", []byte("b")), ShouldBeNil)
+		So(upstream.Commit(ctx, "b"), ShouldBeNil)
+		So(upstream.DeleteLocalBranch(ctx, "feature"), ShouldBeNil)
+		dst, err := git.PlainOpen(secondary)
+		So(err, ShouldBeNil)
+
+		// dry run时不fetch、不prune也不推送
+		old := g.ApplyOption(WithDryRun(true))
+		So(mirror.MirrorSync(ctx), ShouldBeNil)
+		g.ApplyOption(old...)
+		for _, repo := range []*git.Repository{mirror.(*repository).Repository, dst} {
+			_, err = repo.Reference(plumbing.NewBranchReferenceName("feature"), false)
+			So(err, ShouldBeNil)
+		}
+
+		So(mirror.MirrorSync(ctx), ShouldBeNil)
+		ref, err := dst.Reference(plumbing.Master, false)
+		So(err, ShouldBeNil)
+		head, err := upstream.(*repository).Head()
+		So(err, ShouldBeNil)
+		So(ref.Hash(), ShouldEqual, head.Hash())
+		_, err = dst.Reference(plumbing.NewBranchReferenceName("feature"), false)
+		So(errors.Is(err, ErrReferenceNotFound), ShouldBeTrue)
+	})
+}
@@ -0,0 +1,371 @@
+package gittools
+
+import (
+	"context"
+	"errors"
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/osfs"
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	formatcfg "github.com/go-git/go-git/v5/plumbing/format/config"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/capability"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/sideband"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	"github.com/go-git/go-git/v5/storage"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	// FilterBlobNone 不下载任何blob，等同于git clone --filter=blob:none
+	FilterBlobNone = "blob:none"
+	// FilterTreeNone 不下载任何tree以及blob，仅下载commit，等同于git clone --filter=tree:0
+	FilterTreeNone = "tree:0"
+)
+
+// ErrFilterNotSupported 远端不支持partial clone，服务端需要开启uploadpack.allowFilter
+var ErrFilterNotSupported = errors.New("remote does not support partial clone filter")
+
+// FilterBlobLimit 不下载大小大于等于n字节的blob，等同于git clone --filter=blob:limit=<n>
+func FilterBlobLimit(n uint64) string {
+	return string(packp.FilterBlobLimit(n, packp.BlobLimitPrefixNone))
+}
+
+// promisor partial clone时缺失对象的来源，与git的promisor remote一致
+type promisor struct {
+	h      *cloner
+	remote string
+	url    string
+	filter packp.Filter
+	s      storage.Storer
+	mu     sync.Mutex
+	ctx    context.Context
+}
+
+// bind 按需获取缺失的对象时使用操作的ctx，返回恢复函数
+func (p *promisor) bind(ctx context.Context) func() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	old := p.ctx
+	p.ctx = ctx
+	return func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.ctx = old
+	}
+}
+
+// context 当前操作的ctx，不在操作中时为context.Background()
+func (p *promisor) context() context.Context {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.ctx == nil {
+		return context.Background()
+	}
+	return p.ctx
+}
+
+// fetch 从promisor remote获取wants返回的对象，depth大于0时记录shallow，失败时按照RetryPolicy重试
+func (p *promisor) fetch(ctx context.Context, depth int, wants func(ar *packp.AdvRefs) []plumbing.Hash) error {
+	return p.h.retry(ctx, "promisor fetch", func() error { return p.fetchOnce(ctx, depth, wants) })
+}
+
+func (p *promisor) fetchOnce(ctx context.Context, depth int, wants func(ar *packp.AdvRefs) []plumbing.Hash) (err error) {
+	var auth transport.AuthMethod
+	if auth, err = p.h.authForURL(p.url); err != nil {
+		return
+	}
+	var ep *transport.Endpoint
+	if ep, err = transport.NewEndpoint(p.url); err != nil {
+		return
+	}
+	var cli transport.Transport
+	if cli, err = client.NewClient(ep); err != nil {
+		return
+	}
+	var sess transport.UploadPackSession
+	if sess, err = cli.NewUploadPackSession(ep, auth); err != nil {
+		return
+	}
+	defer func() {
+		if err0 := sess.Close(); err == nil {
+			err = err0
+		}
+	}()
+	var ar *packp.AdvRefs
+	if ar, err = sess.AdvertisedReferencesContext(ctx); err != nil {
+		return
+	}
+	if !ar.Capabilities.Supports(capability.Filter) {
+		return ErrFilterNotSupported
+	}
+	req := packp.NewUploadPackRequestFromCapabilities(ar.Capabilities)
+	req.Filter = p.filter
+	if err = req.Capabilities.Set(capability.Filter); err != nil {
+		return
+	}
+	if ar.Capabilities.Supports(capability.IncludeTag) {
+		if err = req.Capabilities.Set(capability.IncludeTag); err != nil {
+			return
+		}
+	}
+	if depth > 0 {
+		if err = req.Capabilities.Set(capability.Shallow); err != nil {
+			return
+		}
+		req.Depth = packp.DepthCommits(depth)
+	}
+	if req.Wants = wants(ar); len(req.Wants) == 0 {
+		return
+	}
+	var resp *packp.UploadPackResponse
+	if resp, err = sess.UploadPack(p.h.metered(ctx, "promisor fetch"), req); err != nil {
+		if errors.Is(err, transport.ErrEmptyUploadPackRequest) {
+			err = nil
+		}
+		return
+	}
+	defer func() {
+		if err0 := resp.Close(); err == nil {
+			err = err0
+		}
+	}()
+	if depth > 0 && len(resp.Shallows) > 0 {
+		if err = p.s.SetShallow(resp.Shallows); err != nil {
+			return
+		}
+	}
+	var reader io.Reader = resp
+	switch {
+	case req.Capabilities.Supports(capability.Sideband64k):
+		reader = sideband.NewDemuxer(sideband.Sideband64k, resp)
+	case req.Capabilities.Supports(capability.Sideband):
+		reader = sideband.NewDemuxer(sideband.Sideband, resp)
+	}
+	if d, ok := reader.(*sideband.Demuxer); ok {
+		d.Progress = p.h.progress(ctx, "promisor fetch")
+	}
+	err = packfile.UpdateObjectStorage(p.s, reader)
+	return
+}
+
+// fetchObjects 按需获取缺失的对象
+func (p *promisor) fetchObjects(ctx context.Context, hashes ...plumbing.Hash) error {
+	return p.fetch(ctx, 0, func(*packp.AdvRefs) []plumbing.Hash { return hashes })
+}
+
+// fetchRefs clone时按照filter获取mode所需ref指向的对象，ref的更新仍交由go-git完成
+func (p *promisor) fetchRefs(ctx context.Context, depth int, mode cloneMode) error {
+	return p.fetch(ctx, depth, func(ar *packp.AdvRefs) []plumbing.Hash {
+		var wants []plumbing.Hash
+		seen := make(map[plumbing.Hash]struct{})
+		add := func(h plumbing.Hash) {
+			if _, ok := seen[h]; !ok {
+				seen[h] = struct{}{}
+				wants = append(wants, h)
+			}
+		}
+		if ar.Head != nil {
+			add(*ar.Head)
+		}
+		for name, h := range ar.References {
+			if mode == cloneModeMirror || strings.HasPrefix(name, branchRefPrefix) {
+				add(h)
+			}
+		}
+		return wants
+	})
+}
+
+// saveConfig 写入partial clone的配置，与git保持一致，使git命令行也能按需获取缺失的对象
+func (p *promisor) saveConfig(r *git.Repository) error {
+	c, err := r.Config()
+	if err != nil {
+		return err
+	}
+	c.Core.RepositoryFormatVersion = formatcfg.Version_1
+	if len(c.Extensions.ObjectFormat) == 0 {
+		c.Extensions.ObjectFormat = "sha1"
+	}
+	c.Raw.Section("extensions").SetOption("partialclone", p.remote)
+	c.Raw.Section("remote").Subsection(p.remote).
+		SetOption("promisor", "true").
+		SetOption("partialclonefilter", string(p.filter))
+	return r.SetConfig(c)
+}
+
+// loadPromisor 读取partial clone的配置，非partial clone返回nil
+func (h *cloner) loadPromisor(c *config.Config, s storage.Storer) *promisor {
+	remote := c.Raw.Section("extensions").Option("partialclone")
+	if len(remote) == 0 {
+		return nil
+	}
+	rc, ok := c.Remotes[remote]
+	if !ok || len(rc.URLs) == 0 {
+		return nil
+	}
+	return &promisor{
+		h:      h,
+		remote: remote,
+		url:    rc.URLs[0],
+		filter: packp.Filter(c.Raw.Section("remote").Subsection(remote).Option("partialclonefilter")),
+		s:      s,
+	}
+}
+
+// promisorStorer 读取blob或者tree缺失时，从promisor remote按需获取
+type promisorStorer struct {
+	storage.Storer
+	p *promisor
+}
+
+func (s *promisorStorer) EncodedObject(t plumbing.ObjectType, h plumbing.Hash) (plumbing.EncodedObject, error) {
+	obj, err := s.Storer.EncodedObject(t, h)
+	// commit缺失是shallow的边界，不需要获取
+	if err != plumbing.ErrObjectNotFound || (t != plumbing.BlobObject && t != plumbing.TreeObject) {
+		return obj, err
+	}
+	// go-git读取对象时不传递ctx，使用当前操作的ctx并受FetchTimeout限制
+	ctx, cancel := withTimeout(s.p.context(), s.p.h.GetFetchTimeout())
+	defer cancel()
+	if err = s.p.fetchObjects(ctx, h); err != nil {
+		return nil, err
+	}
+	return s.Storer.EncodedObject(t, h)
+}
+
+// fsPromisorStorer 基于文件系统的promisorStorer，go-git通过类型断言使用Init、Filesystem以及PackfileWriter
+type fsPromisorStorer struct {
+	*promisorStorer
+	fs *filesystem.Storage
+}
+
+func (s *fsPromisorStorer) Init() error { return s.fs.Init() }
+
+func (s *fsPromisorStorer) Filesystem() billy.Filesystem { return s.fs.Filesystem() }
+
+func (s *fsPromisorStorer) PackfileWriter() (io.WriteCloser, error) { return s.fs.PackfileWriter() }
+
+func newPromisorStorer(p *promisor) storage.Storer {
+	ps := &promisorStorer{Storer: p.s, p: p}
+	if fs, ok := p.s.(*filesystem.Storage); ok {
+		return &fsPromisorStorer{promisorStorer: ps, fs: fs}
+	}
+	return ps
+}
+
+// promisor 若Repository是partial clone，返回promisor，否则返回nil
+func (r *repository) promisor() *promisor {
+	switch s := r.Storer.(type) {
+	case *promisorStorer:
+		return s.p
+	case *fsPromisorStorer:
+		return s.p
+	}
+	return nil
+}
+
+// bind partial clone在操作期间按需获取缺失的对象时使用ctx，返回还原函数，用法为defer r.bind(ctx)()
+// 修改操作在lockFile中绑定，只读操作需要在加锁后单独绑定
+func (r *repository) bind(ctx context.Context) func() {
+	if p := r.promisor(); p != nil {
+		return p.bind(ctx)
+	}
+	return func() {}
+}
+
+// fetchMissingBlobs checkout前一次性获取rev对应tree中sparse checkout目录内缺失的blob，避免逐个按需获取
+func (r *repository) fetchMissingBlobs(ctx context.Context, rev plumbing.Revision) error {
+	p := r.promisor()
+	if p == nil {
+		return nil
+	}
+	hash, err := r.ResolveRevision(rev)
+	if err != nil {
+		return err
+	}
+	var c *object.Commit
+	if c, err = r.CommitObject(*hash); err != nil {
+		return err
+	}
+	var tree *object.Tree
+	if tree, err = c.Tree(); err != nil {
+		return err
+	}
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	var missing []plumbing.Hash
+	for {
+		name, entry, err0 := walker.Next()
+		if err0 == io.EOF {
+			break
+		} else if err0 != nil {
+			return err0
+		}
+		if !entry.Mode.IsFile() || entry.Mode == filemode.Submodule || !r.inSparsePaths(name) {
+			continue
+		}
+		if r.Storer.HasEncodedObject(entry.Hash) == plumbing.ErrObjectNotFound {
+			missing = append(missing, entry.Hash)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return p.fetchObjects(ctx, missing...)
+}
+
+// openPromisor 若r是partial clone，使用promisorStorer重新打开，使缺失的对象可以按需获取
+func (h *cloner) openPromisor(r *git.Repository) (*git.Repository, error) {
+	c, err := r.Config()
+	if err != nil {
+		return nil, err
+	}
+	p := h.loadPromisor(c, r.Storer)
+	if p == nil {
+		return r, nil
+	}
+	var wt billy.Filesystem
+	if w, err0 := r.Worktree(); err0 == nil {
+		wt = w.Filesystem
+	}
+	return git.Open(newPromisorStorer(p), wt)
+}
+
+// partialClone 按照Filter进行partial clone，仅获取对象，ref、HEAD以及分支配置仍由go-git完成，不checkout
+func (h *cloner) partialClone(ctx context.Context, dir string, mode cloneMode, opts *git.CloneOptions) (*git.Repository, error) {
+	var s storage.Storer
+	var wt billy.Filesystem
+	switch {
+	case len(dir) == 0:
+		s, wt = memory.NewStorage(), memfs.New()
+	case mode == cloneModeWorktree:
+		s, wt = filesystem.NewStorage(osfs.New(filepath.Join(dir, git.GitDirName)), cache.NewObjectLRUDefault()), osfs.New(dir)
+	default:
+		s = filesystem.NewStorage(osfs.New(dir), cache.NewObjectLRUDefault())
+	}
+	p := &promisor{h: h, remote: DefaultRemoteName, url: opts.URL, filter: packp.Filter(h.GetFilter()), s: s}
+	if err := p.fetchRefs(ctx, opts.Depth, mode); err != nil {
+		return nil, err
+	}
+	r, err := git.CloneContext(ctx, newPromisorStorer(p), wt, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err = p.saveConfig(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
@@ -0,0 +1,97 @@
+package gittools
+
+import (
+	"context"
+	"errors"
+	"github.com/go-git/go-git/v5/plumbing"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+// allowFilter 允许upstream作为partial clone的远端
+func allowFilter(r Repository) error {
+	c, err := r.(*repository).Config()
+	if err != nil {
+		return err
+	}
+	c.Raw.Section("uploadpack").SetOption("allowFilter", "true").SetOption("allowAnySHA1InWant", "true")
+	return r.(*repository).SetConfig(c)
+}
+
+func TestPartialClone(t *testing.T) {
+	Convey("partial clone", t, func() {
+		ctx := context.Background()
+		g, upstream := newLocalRepository(t)
+		So(upstream.RewriteFile(ctx, "a.txt", []byte("v1")), ShouldBeNil)
+		So(upstream.Commit(ctx, "v1"), ShouldBeNil)
+		first := upstream.(*repository).headHash
+		So(upstream.RewriteFile(ctx, "a.txt", []byte("v2")), ShouldBeNil)
+		So(upstream.RewriteFile(ctx, "dir/b.txt", []byte("b")), ShouldBeNil)
+		So(upstream.Commit(ctx, "v2"), ShouldBeNil)
+
+		Convey("not supported", func() {
+			old := g.ApplyOption(WithFilter(FilterBlobNone))
+			defer g.ApplyOption(old...)
+			_, err := g.CloneToMemory(ctx, upstream.Root())
+			So(errors.Is(err, ErrFilterNotSupported), ShouldBeTrue)
+		})
+
+		So(allowFilter(upstream), ShouldBeNil)
+
+		Convey("blob:none", func() {
+			old := g.ApplyOption(WithFilter(FilterBlobNone), WithDepth(0))
+			defer g.ApplyOption(old...)
+			r, err := g.Clone(ctx, upstream.Root(), "")
+			So(err, ShouldBeNil)
+			defer func() { _ = r.RemoveAll() }()
+			is, err := r.IsClean()
+			So(err, ShouldBeNil)
+			So(is, ShouldBeTrue)
+
+			c, err := r.(*repository).CommitObject(first)
+			So(err, ShouldBeNil)
+			tree, err := c.Tree()
+			So(err, ShouldBeNil)
+			entry, err := tree.FindEntry("a.txt")
+			So(err, ShouldBeNil)
+			So(r.(*repository).Storer.HasEncodedObject(entry.Hash), ShouldEqual, plumbing.ErrObjectNotFound)
+
+			r, err = g.Open(ctx, r.Root())
+			So(err, ShouldBeNil)
+			So(r.(*repository).promisor(), ShouldNotBeNil)
+			canceled, cancel := context.WithCancel(ctx)
+			cancel()
+			restore := r.(*repository).bind(canceled)
+			_, err = r.(*repository).Storer.EncodedObject(plumbing.BlobObject, entry.Hash)
+			So(errors.Is(err, context.Canceled), ShouldBeTrue)
+			restore()
+			So(r.(*repository).promisor().context(), ShouldResemble, context.Background())
+			_, err = r.LFSFiles(ctx)
+			So(err, ShouldBeNil)
+			So(r.(*repository).promisor().context(), ShouldResemble, context.Background())
+			c, err = r.(*repository).CommitObject(first)
+			So(err, ShouldBeNil)
+			f, err := c.File("a.txt")
+			So(err, ShouldBeNil)
+			content, err := f.Contents()
+			So(err, ShouldBeNil)
+			So(content, ShouldEqual, "v1")
+		})
+
+		Convey("tree:0 to memory", func() {
+			old := g.ApplyOption(WithFilter(FilterTreeNone), WithSparsePaths("dir"))
+			defer g.ApplyOption(old...)
+			r, err := g.CloneToMemory(ctx, upstream.Root())
+			So(err, ShouldBeNil)
+			wt, err := r.(*repository).Worktree()
+			So(err, ShouldBeNil)
+			_, err = wt.Filesystem.Stat("dir/b.txt")
+			So(err, ShouldBeNil)
+			_, err = wt.Filesystem.Stat("a.txt")
+			So(err, ShouldNotBeNil)
+			So(r.SetSparsePaths(ctx), ShouldBeNil)
+			_, err = wt.Filesystem.Stat("a.txt")
+			So(err, ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,304 @@
+package gittools
+
+import (
+	"context"
+	"errors"
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrPoolClosed Pool已关闭
+var ErrPoolClosed = errors.New("pool closed")
+
+// PoolOptions Cloner.NewPool 的参数
+type PoolOptions struct {
+	// MaxSize 工作区数量上限，包括已租出的工作区，达到上限时Acquire等待归还，为0则不限制
+	MaxSize int
+	// IdleTimeout 空闲超过该时间的工作区将被后台定期删除，为0则不删除
+	IdleTimeout time.Duration
+	// Dir 工作区所在的目录，为空则为临时目录
+	Dir string
+}
+
+// Pool 同一url的工作区池，每个工作区同时只会租给一个调用方
+type Pool interface {
+	// Acquire 租用一个工作区，丢弃其中所有的修改以及未跟踪的文件，并fetch后重置到ref
+	// ref可以是分支、标签或者commit hash，为空则为clone时的默认分支
+	Acquire(ctx context.Context, ref string) (PooledRepository, error)
+	// Idle 空闲的工作区数量
+	Idle() int
+	// Close 关闭Pool并删除空闲的工作区，已租出的工作区在归还时删除
+	Close() error
+}
+
+// PooledRepository 从Pool租用的工作区，使用完毕后需要调用Release或者Discard
+type PooledRepository interface {
+	Repository
+	// Release 归还工作区
+	Release()
+	// Discard 删除工作区而不归还，用于工作区已损坏的情况
+	Discard() error
+}
+
+type pool struct {
+	h      *cloner
+	url    string
+	o      PoolOptions
+	sem    chan struct{}
+	mu     sync.Mutex
+	idle   []*pooledRepository
+	closed bool
+	stop   chan struct{}
+}
+
+type pooledRepository struct {
+	*repository
+	p        *pool
+	branch   string
+	lastUsed time.Time
+	done     bool
+}
+
+// interceptedPooledRepository 配置了拦截器或者Tracer时Acquire返回的工作区
+type interceptedPooledRepository struct {
+	*interceptedRepository
+	*pooledRepository
+}
+
+func (h *cloner) NewPool(url string, opts PoolOptions) Pool {
+	p := &pool{h: h, url: url, o: opts}
+	if opts.MaxSize > 0 {
+		p.sem = make(chan struct{}, opts.MaxSize)
+	}
+	if opts.IdleTimeout > 0 {
+		p.stop = make(chan struct{})
+		go p.janitor()
+	}
+	return p
+}
+
+// janitor 定期删除空闲超时的工作区，直到Pool关闭
+func (p *pool) janitor() {
+	ticker := time.NewTicker(p.o.IdleTimeout)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.mu.Lock()
+			expired := p.evict()
+			p.mu.Unlock()
+			for _, e := range expired {
+				_ = e.RemoveAll()
+			}
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+func (p *pool) Acquire(ctx context.Context, ref string) (pr PooledRepository, err error) {
+	defer func(start time.Time) {
+		p.h.done(start, &err, "pool acquire", Field{FieldURL, redactURL(p.url)}, Field{FieldRef, ref})
+	}(time.Now())
+	if p.sem != nil {
+		select {
+		case p.sem <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	var e *pooledRepository
+	if e, err = p.get(ctx); err == nil {
+		if len(ref) == 0 {
+			ref = e.branch
+		}
+		if err = e.resetTo(ctx, ref); err != nil {
+			_ = e.RemoveAll()
+		}
+	}
+	if err != nil {
+		p.done()
+		return nil, err
+	}
+	if p.h.intercepting() {
+		return &interceptedPooledRepository{interceptedRepository: &interceptedRepository{r: e.repository}, pooledRepository: e}, nil
+	}
+	return e, nil
+}
+
+// get 取出最近归还的空闲工作区，没有则clone
+func (p *pool) get(ctx context.Context) (*pooledRepository, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrPoolClosed
+	}
+	expired := p.evict()
+	var e *pooledRepository
+	if n := len(p.idle); n > 0 {
+		e, p.idle = p.idle[n-1], p.idle[:n-1]
+		e.done = false
+	}
+	p.mu.Unlock()
+	for _, v := range expired {
+		_ = v.RemoveAll()
+	}
+	if e != nil {
+		return e, nil
+	}
+	dir, err := ioutil.TempDir(p.o.Dir, "")
+	if err != nil {
+		return nil, err
+	}
+	var r Repository
+	if r, err = p.h.cloneToDir(ctx, p.url, dir, "", cloneModeWorktree); err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+	repo := r.(*repository)
+	return &pooledRepository{repository: repo, p: p, branch: repo.currentRefName.Short()}, nil
+}
+
+// evict 移出空闲超时的工作区，需要持有锁
+func (p *pool) evict() []*pooledRepository {
+	if p.o.IdleTimeout <= 0 {
+		return nil
+	}
+	var expired []*pooledRepository
+	idle := p.idle[:0]
+	for _, e := range p.idle {
+		if time.Since(e.lastUsed) > p.o.IdleTimeout {
+			expired = append(expired, e)
+		} else {
+			idle = append(idle, e)
+		}
+	}
+	p.idle = idle
+	return expired
+}
+
+// done 释放一个工作区名额
+func (p *pool) done() {
+	if p.sem != nil {
+		<-p.sem
+	}
+}
+
+func (p *pool) Idle() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.idle)
+}
+
+func (p *pool) Close() (err error) {
+	defer func(start time.Time) { p.h.done(start, &err, "pool close", Field{FieldURL, redactURL(p.url)}) }(time.Now())
+	p.mu.Lock()
+	idle, closed := p.idle, p.closed
+	p.idle, p.closed = nil, true
+	p.mu.Unlock()
+	if p.stop != nil && !closed {
+		close(p.stop)
+	}
+	for _, e := range idle {
+		if err0 := e.RemoveAll(); err == nil {
+			err = err0
+		}
+	}
+	return
+}
+
+func (pr *pooledRepository) Release() {
+	p := pr.p
+	p.mu.Lock()
+	if pr.done {
+		p.mu.Unlock()
+		return
+	}
+	pr.done = true
+	closed := p.closed
+	if !closed {
+		pr.lastUsed = time.Now()
+		p.idle = append(p.idle, pr)
+	}
+	p.mu.Unlock()
+	if closed {
+		_ = pr.RemoveAll()
+	}
+	p.done()
+}
+
+func (pr *pooledRepository) Discard() error {
+	p := pr.p
+	p.mu.Lock()
+	if pr.done {
+		p.mu.Unlock()
+		return nil
+	}
+	pr.done = true
+	p.mu.Unlock()
+	p.done()
+	return pr.RemoveAll()
+}
+
+// resetTo fetch后将工作区重置到ref，等同于git reset --hard <ref> && git clean -fd
+// 远端分支会检出为同名本地分支，标签以及commit hash则为detached HEAD
+func (r *repository) resetTo(ctx context.Context, ref string) (err error) {
+	defer func(start time.Time) { r.done(start, &err, "reset to", Field{"want", ref}) }(time.Now())
+	ctx, cancel := withTimeout(ctx, r.h.GetFetchTimeout())
+	defer cancel()
+	var auth transport.AuthMethod
+	if auth, err = r.remoteAuth(DefaultRemoteName); err != nil {
+		return
+	}
+	if err = checkErr(r.h.retry(ctx, "fetch", func() error {
+		return r.Repository.FetchContext(r.h.metered(ctx, "fetch"), &git.FetchOptions{
+			RemoteName: DefaultRemoteName,
+			Auth:       auth,
+			Progress:   r.h.progress(ctx, "fetch"),
+			Tags:       git.AllTags,
+			Prune:      true,
+			Force:      true,
+		})
+	})); err != nil {
+		return
+	}
+	var head *plumbing.Reference
+	var hash *plumbing.Hash
+	if remoteRef, err0 := r.Reference(getBranchRemoteReferenceName(DefaultRemoteName, ref), true); err0 == nil {
+		branch := getBranchReferenceName(ref)
+		if err = r.Storer.SetReference(plumbing.NewHashReference(branch, remoteRef.Hash())); err != nil {
+			return
+		}
+		head = plumbing.NewSymbolicReference(plumbing.HEAD, branch)
+		h := remoteRef.Hash()
+		hash = &h
+	} else {
+		if hash, err = r.ResolveRevision(plumbing.Revision(ref)); err != nil {
+			return
+		}
+		head = plumbing.NewHashReference(plumbing.HEAD, *hash)
+	}
+	if err = r.Storer.SetReference(head); err != nil {
+		return
+	}
+	var workTree *git.Worktree
+	if workTree, err = r.Worktree(); err != nil {
+		return
+	}
+	if err = r.resetSparse(ctx, workTree, *hash); err != nil {
+		return
+	}
+	if err = workTree.Clean(&git.CleanOptions{Dir: true}); err != nil {
+		return
+	}
+	if err = r.updateHeadHash(); err != nil {
+		return
+	}
+	err = r.afterCheckout(ctx)
+	return
+}
@@ -0,0 +1,94 @@
+package gittools
+
+import (
+	"context"
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPool(t *testing.T) {
+	Convey("pool", t, func() {
+		ctx := context.Background()
+		g, upstream := newLocalRepository(t)
+		init := upstream.(*repository).headHash
+		So(upstream.RewriteFile(ctx, "README.md", []byte("v2")), ShouldBeNil)
+		So(upstream.Commit(ctx, "v2"), ShouldBeNil)
+		_, err := upstream.CreateTag(ctx, "v1", "v1", init.String())
+		So(err, ShouldBeNil)
+		p := g.NewPool(upstream.Root(), PoolOptions{MaxSize: 1, Dir: t.TempDir()})
+		defer func() { So(p.Close(), ShouldBeNil) }()
+
+		r, err := p.Acquire(ctx, "")
+		So(err, ShouldBeNil)
+		root := r.Root()
+		So(r.(*pooledRepository).headHash, ShouldEqual, upstream.(*repository).headHash)
+		So(r.RewriteFile(ctx, "dirty.txt", []byte("dirty")), ShouldBeNil)
+		So(os.WriteFile(filepath.Join(root, "untracked.txt"), []byte("untracked"), 0644), ShouldBeNil)
+
+		Convey("max size", func() {
+			timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+			defer cancel()
+			_, err := p.Acquire(timeout, "")
+			So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+		})
+
+		Convey("reuse and reset", func() {
+			r.Release()
+			r.Release()
+			So(p.Idle(), ShouldEqual, 1)
+			r, err := p.Acquire(ctx, "v1")
+			So(err, ShouldBeNil)
+			So(r.Root(), ShouldEqual, root)
+			So(r.(*pooledRepository).headHash, ShouldEqual, init)
+			clean, err := r.IsClean()
+			So(err, ShouldBeNil)
+			So(clean, ShouldBeTrue)
+			So(r.Discard(), ShouldBeNil)
+			So(p.Idle(), ShouldEqual, 0)
+			_, err = os.Stat(root)
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+
+		Convey("idle eviction", func() {
+			p := g.NewPool(upstream.Root(), PoolOptions{IdleTimeout: time.Millisecond})
+			defer func() { So(p.Close(), ShouldBeNil) }()
+			r1, err := p.Acquire(ctx, "master")
+			So(err, ShouldBeNil)
+			r1.Release()
+			time.Sleep(5 * time.Millisecond)
+			r2, err := p.Acquire(ctx, "master")
+			So(err, ShouldBeNil)
+			defer r2.Release()
+			So(r2.Root(), ShouldNotEqual, r1.Root())
+			_, err = os.Stat(r1.Root())
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+
+		Convey("background eviction", func() {
+			p := g.NewPool(upstream.Root(), PoolOptions{IdleTimeout: 10 * time.Millisecond})
+			defer func() { So(p.Close(), ShouldBeNil) }()
+			r, err := p.Acquire(ctx, "master")
+			So(err, ShouldBeNil)
+			r.Release()
+			time.Sleep(50 * time.Millisecond)
+			So(p.Idle(), ShouldEqual, 0)
+			_, err = os.Stat(r.Root())
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+
+		Convey("failed clone", func() {
+			dir := t.TempDir()
+			p := g.NewPool(filepath.Join(dir, "missing"), PoolOptions{Dir: dir})
+			defer func() { So(p.Close(), ShouldBeNil) }()
+			_, err := p.Acquire(ctx, "")
+			So(err, ShouldNotBeNil)
+			entries, err := os.ReadDir(dir)
+			So(err, ShouldBeNil)
+			So(entries, ShouldBeEmpty)
+		})
+	})
+}
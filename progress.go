@@ -0,0 +1,119 @@
+package gittools
+
+import (
+	"bytes"
+	"context"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/sideband"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ProgressEvent clone、fetch、push以及LFS传输的进度
+type ProgressEvent struct {
+	// Op 操作名称，与日志中的op一致，如clone、fetch、push、lfs download
+	Op string
+	// Phase 当前阶段，如Counting objects、Receiving objects、Resolving deltas
+	Phase string
+	// Current 当前阶段已完成的数量
+	Current int64
+	// Total 当前阶段的总数，未知时为0
+	Total int64
+	// Bytes 已传输的字节数，未知时为0
+	Bytes int64
+	// Done 当前阶段是否已完成
+	Done bool
+}
+
+// ProgressFunc 接收进度事件，同一操作的事件按顺序回调
+type ProgressFunc func(e ProgressEvent)
+
+var (
+	// progressPercentRegexp 如Receiving objects:  45% (450/1000), 1.20 MiB | 2.00 MiB/s
+	progressPercentRegexp = regexp.MustCompile(`^([A-Za-z][A-Za-z ]*):\s+\d+% \((\d+)/(\d+)\)(.*)$`)
+	// progressCountRegexp 如Enumerating objects: 5, done.
+	progressCountRegexp = regexp.MustCompile(`^([A-Za-z][A-Za-z ]*):\s+(\d+)(.*)$`)
+	// progressBytesRegexp 如1.20 MiB
+	progressBytesRegexp = regexp.MustCompile(`([\d.]+) (bytes|KiB|MiB|GiB)`)
+)
+
+var progressUnits = map[string]float64{
+	"bytes": 1,
+	"KiB":   1 << 10,
+	"MiB":   1 << 20,
+	"GiB":   1 << 30,
+}
+
+// parseProgress 解析sideband中的一行进度，无法识别时返回false
+func parseProgress(line string) (e ProgressEvent, ok bool) {
+	line = strings.TrimSpace(strings.TrimPrefix(line, "remote:"))
+	var rest string
+	if m := progressPercentRegexp.FindStringSubmatch(line); m != nil {
+		e.Phase = m[1]
+		e.Current, _ = strconv.ParseInt(m[2], 10, 64)
+		e.Total, _ = strconv.ParseInt(m[3], 10, 64)
+		rest = m[4]
+	} else if m = progressCountRegexp.FindStringSubmatch(line); m != nil {
+		e.Phase = m[1]
+		e.Current, _ = strconv.ParseInt(m[2], 10, 64)
+		rest = m[3]
+	} else {
+		return e, false
+	}
+	if m := progressBytesRegexp.FindStringSubmatch(rest); m != nil {
+		n, _ := strconv.ParseFloat(m[1], 64)
+		e.Bytes = int64(n * progressUnits[m[2]])
+	}
+	e.Done = strings.Contains(rest, "done")
+	return e, true
+}
+
+// progressWriter 将sideband输出的进度文本解析为ProgressEvent
+type progressWriter struct {
+	h   *cloner
+	ctx context.Context
+	op  string
+	buf []byte
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		// 进度使用\r刷新当前行，完成时使用\n换行
+		i := bytes.IndexAny(w.buf, "\r\n")
+		if i < 0 {
+			break
+		}
+		if e, ok := parseProgress(string(w.buf[:i])); ok {
+			e.Op = w.op
+			w.h.notify(w.ctx, e)
+		}
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// progress 返回op的sideband进度输出，未设置Progress并且ctx中没有span时丢弃
+func (h *cloner) progress(ctx context.Context, op string) sideband.Progress {
+	if h.GetProgress() == nil && spanFromContext(ctx) == nil {
+		return nil
+	}
+	return &progressWriter{h: h, ctx: ctx, op: op}
+}
+
+// notify 回调Progress，阶段完成时将对象数量以及字节数记录到span
+func (h *cloner) notify(ctx context.Context, e ProgressEvent) {
+	if f := h.GetProgress(); f != nil {
+		f(e)
+	}
+	if !e.Done {
+		return
+	}
+	if span := spanFromContext(ctx); span != nil {
+		phase := strings.ToLower(strings.ReplaceAll(e.Phase, " ", "_"))
+		span.SetAttributes(Field{"progress." + phase, e.Current})
+		if e.Bytes > 0 {
+			span.SetAttributes(Field{"progress." + phase + "_bytes", e.Bytes})
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package gittools
+
+import (
+	"context"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestProgress(t *testing.T) {
+	Convey("progress", t, func() {
+		Convey("parse", func() {
+			for line, want := range map[string]ProgressEvent{
+				"Enumerating objects: 5, done.":                                       {Phase: "Enumerating objects", Current: 5, Done: true},
+				"remote: Counting objects:  50% (5/10)":                               {Phase: "Counting objects", Current: 5, Total: 10},
+				"Receiving objects:  45% (450/1000), 1.50 MiB | 2.00 MiB/s":           {Phase: "Receiving objects", Current: 450, Total: 1000, Bytes: 3 << 19},
+				"Receiving objects: 100% (1000/1000), 512.00 KiB | 1.00 MiB/s, done.": {Phase: "Receiving objects", Current: 1000, Total: 1000, Bytes: 512 << 10, Done: true},
+			} {
+				got, ok := parseProgress(line)
+				So(ok, ShouldBeTrue)
+				So(got, ShouldResemble, want)
+			}
+			_, ok := parseProgress("Total 3 (delta 0), reused 0 (delta 0)")
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("writer", func() {
+			var events []ProgressEvent
+			h := New(WithProgress(func(e ProgressEvent) { events = append(events, e) })).(*cloner)
+			w := h.progress(context.Background(), "fetch")
+			for _, s := range []string{"Counting objects:  50% (1/2)\rCounting ", "objects: 100% (2/2)\r", "Counting objects: 100% (2/2), done.\n"} {
+				_, err := w.Write([]byte(s))
+				So(err, ShouldBeNil)
+			}
+			So(events, ShouldResemble, []ProgressEvent{
+				{Op: "fetch", Phase: "Counting objects", Current: 1, Total: 2},
+				{Op: "fetch", Phase: "Counting objects", Current: 2, Total: 2},
+				{Op: "fetch", Phase: "Counting objects", Current: 2, Total: 2, Done: true},
+			})
+			So(New().(*cloner).progress(context.Background(), "fetch"), ShouldBeNil)
+		})
+	})
+}
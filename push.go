@@ -0,0 +1,298 @@
+package gittools
+
+import (
+	"context"
+	"fmt"
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"regexp"
+	"time"
+)
+
+// RefStatus ref的更新状态
+type RefStatus string
+
+const (
+	// RefStatusUpToDate 远端已是最新，无需更新
+	RefStatusUpToDate RefStatus = "up-to-date"
+	// RefStatusCreated 远端新建ref
+	RefStatusCreated RefStatus = "created"
+	// RefStatusUpdated fast-forward更新
+	RefStatusUpdated RefStatus = "updated"
+	// RefStatusForced 强制更新
+	RefStatusForced RefStatus = "forced"
+	// RefStatusDeleted 远端删除ref
+	RefStatusDeleted RefStatus = "deleted"
+	// RefStatusRejected 更新被拒绝
+	RefStatusRejected RefStatus = "rejected"
+	// RefStatusUnknown push失败且无法确认远端是否已更新
+	RefStatusUnknown RefStatus = "unknown"
+)
+
+// RefUpdate 单个ref的更新结果
+type RefUpdate struct {
+	// Name 远端ref名称，如refs/heads/master
+	Name string
+	// Old 更新前的hash，为空表示ref不存在
+	Old string
+	// New 更新后的hash，为空表示删除ref
+	New string
+	// Status 更新状态
+	Status RefStatus
+	// Reason 被拒绝的原因
+	Reason string
+}
+
+func (u RefUpdate) String() string {
+	s := fmt.Sprintf("%s %s %s..%s", u.Status, u.Name, shortHash(u.Old), shortHash(u.New))
+	if len(u.Reason) > 0 {
+		s += " (" + u.Reason + ")"
+	}
+	return s
+}
+
+// shortHash hash的前7位，为空时为0000000
+func shortHash(h string) string {
+	if len(h) == 0 {
+		return "0000000"
+	}
+	if len(h) > 7 {
+		return h[:7]
+	}
+	return h
+}
+
+// Lease force-with-lease 的期望值
+type Lease struct {
+	// Ref 需要保护的远端ref，为空则保护所有推送的ref
+	Ref string
+	// Hash 期望的远端hash，为空则使用本地remote tracking ref的hash
+	Hash string
+}
+
+// PushOptions PushWithOptions 的参数
+type PushOptions struct {
+	// Remote remote名称，为空则为origin
+	Remote string
+	// RefSpecs 推送的refspec，如 refs/heads/a:refs/heads/b，为空则推送所有本地分支
+	RefSpecs []string
+	// Force 强制推送
+	Force bool
+	// ForceWithLease 仅当远端ref与期望值一致时才强制推送
+	ForceWithLease *Lease
+	// Atomic 原子推送，所有ref要么全部更新，要么全部不更新，需要远端支持atomic
+	Atomic bool
+	// Options 服务端push options，如GitLab的merge_request.create
+	Options map[string]string
+}
+
+func hashString(h plumbing.Hash) string {
+	if h.IsZero() {
+		return ""
+	}
+	return h.String()
+}
+
+func (o PushOptions) refSpecs() []config.RefSpec {
+	if len(o.RefSpecs) == 0 {
+		return []config.RefSpec{config.RefSpec(config.DefaultPushRefSpec)}
+	}
+	specs := make([]config.RefSpec, 0, len(o.RefSpecs))
+	for _, v := range o.RefSpecs {
+		specs = append(specs, config.RefSpec(v))
+	}
+	return specs
+}
+
+func (r *repository) isFastForward(old, new plumbing.Hash) bool {
+	if old.IsZero() {
+		return true
+	}
+	oc, err := r.CommitObject(old)
+	if err != nil {
+		return false
+	}
+	var nc *object.Commit
+	if nc, err = r.CommitObject(new); err != nil {
+		return false
+	}
+	is, _ := oc.IsAncestor(nc)
+	return is
+}
+
+// pushPlan 根据远端ref计算每个ref将要进行的更新，与go-git的计算方式保持一致
+func (r *repository) pushPlan(remote string, remoteRefs []*plumbing.Reference, o PushOptions) ([]RefUpdate, error) {
+	remotes := make(map[plumbing.ReferenceName]plumbing.Hash, len(remoteRefs))
+	for _, ref := range remoteRefs {
+		if ref.Type() == plumbing.HashReference {
+			remotes[ref.Name()] = ref.Hash()
+		}
+	}
+	iter, err := r.References()
+	if err != nil {
+		return nil, err
+	}
+	var locals []*plumbing.Reference
+	_ = iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference {
+			locals = append(locals, ref)
+		}
+		return nil
+	})
+
+	var updates []RefUpdate
+	add := func(rs config.RefSpec, dst plumbing.ReferenceName, src *plumbing.Reference, new plumbing.Hash) {
+		old, exists := remotes[dst]
+		u := RefUpdate{Name: dst.String(), Old: hashString(old), New: hashString(new)}
+		switch {
+		case old == new:
+			u.Status = RefStatusUpToDate
+		case new.IsZero():
+			u.Status = RefStatusDeleted
+		case !exists:
+			u.Status = RefStatusCreated
+		case o.ForceWithLease != nil && (len(o.ForceWithLease.Ref) == 0 || plumbing.ReferenceName(o.ForceWithLease.Ref) == dst):
+			expected := plumbing.NewHash(o.ForceWithLease.Hash)
+			if len(o.ForceWithLease.Hash) == 0 && src != nil {
+				tracking := plumbing.NewRemoteReferenceName(remote, src.Name().Short())
+				if ref, err0 := storer.ResolveReference(r.Storer, tracking); err0 == nil {
+					expected = ref.Hash()
+				}
+			}
+			if expected == old {
+				u.Status = RefStatusForced
+			} else {
+				u.Status, u.Reason = RefStatusRejected, "stale info"
+			}
+		case r.isFastForward(old, new):
+			u.Status = RefStatusUpdated
+		case o.Force || rs.IsForceUpdate():
+			u.Status = RefStatusForced
+		default:
+			u.Status, u.Reason = RefStatusRejected, "non-fast-forward"
+		}
+		updates = append(updates, u)
+	}
+	for _, rs := range o.refSpecs() {
+		if err = rs.Validate(); err != nil {
+			return nil, err
+		}
+		switch {
+		case rs.IsDelete():
+			if _, ok := remotes[rs.Dst("")]; ok {
+				add(rs, rs.Dst(""), nil, plumbing.ZeroHash)
+			}
+		case rs.IsExactSHA1():
+			add(rs, rs.Dst(""), nil, plumbing.NewHash(rs.Src()))
+		default:
+			for _, ref := range locals {
+				if rs.Match(ref.Name()) {
+					add(rs, rs.Dst(ref.Name()), ref, ref.Hash())
+				}
+			}
+		}
+	}
+	return updates, nil
+}
+
+func (r *repository) PushWithOptions(ctx context.Context, o PushOptions) (updates []RefUpdate, err error) {
+	defer r.lock()()
+	defer func(start time.Time) {
+		r.done(start, &err, "push with options", Field{"remote", getRemoteName(o.Remote)}, Field{"refspecs", o.RefSpecs})
+	}(time.Now())
+	return r.pushWithOptions(ctx, o)
+}
+
+func (r *repository) pushWithOptions(ctx context.Context, o PushOptions) (updates []RefUpdate, err error) {
+	defer r.acquire(ctx, &err)()
+	if err != nil {
+		return
+	}
+	if r.h.GetDryRun() {
+		return r.dryRunPush(o)
+	}
+	ctx, cancel := withTimeout(ctx, r.h.GetPushTimeout())
+	defer cancel()
+	remote := getRemoteName(o.Remote)
+	var auth transport.AuthMethod
+	if auth, err = r.remoteAuth(remote); err != nil {
+		return
+	}
+	var rm *git.Remote
+	if rm, err = r.Repository.Remote(remote); err != nil {
+		return
+	}
+	var remoteRefs []*plumbing.Reference
+	if remoteRefs, err = r.listRemote(ctx, rm, auth); err != nil {
+		return
+	}
+	if updates, err = r.pushPlan(remote, remoteRefs, o); err != nil {
+		return
+	}
+	opts := &git.PushOptions{
+		RemoteName: remote,
+		RefSpecs:   o.refSpecs(),
+		Auth:       auth,
+		Progress:   r.h.progress(ctx, "push"),
+		Force:      o.Force,
+		Options:    o.Options,
+		Atomic:     o.Atomic,
+	}
+	if o.ForceWithLease != nil {
+		opts.ForceWithLease = &git.ForceWithLease{
+			RefName: plumbing.ReferenceName(o.ForceWithLease.Ref),
+			Hash:    plumbing.NewHash(o.ForceWithLease.Hash),
+		}
+	}
+	if err = r.uploadLFS(ctx, updates); err == nil {
+		err = checkErr(r.h.retry(ctx, "push", func() error {
+			return rm.PushContext(r.h.metered(ctx, "push"), opts)
+		}))
+	}
+	if err != nil {
+		r.pushFailed(ctx, rm, auth, o, updates, err)
+	}
+	return
+}
+
+// commandErrorRegexp go-git返回的report-status中第一个被远端拒绝的ref，如command error on refs/heads/master: hook declined
+var commandErrorRegexp = regexp.MustCompile(`command error on (\S+): (.*)`)
+
+// pushFailed push失败后修正updates的状态
+// go-git仅返回report-status中第一个被拒绝的ref，其余ref重新获取远端ref确认是否已更新
+// 远端仍是更新前的hash时标记为RefStatusRejected，无法获取远端ref或者既不是更新前也不是更新后的hash时标记为RefStatusUnknown
+func (r *repository) pushFailed(ctx context.Context, rm *git.Remote, auth transport.AuthMethod, o PushOptions, updates []RefUpdate, err error) {
+	var rejected, reason string
+	if m := commandErrorRegexp.FindStringSubmatch(err.Error()); m != nil {
+		rejected, reason = m[1], m[2]
+	}
+	var remotes map[string]string
+	if refs, err0 := r.listRemote(ctx, rm, auth); err0 == nil {
+		remotes = make(map[string]string, len(refs))
+		for _, ref := range refs {
+			remotes[ref.Name().String()] = hashString(ref.Hash())
+		}
+	}
+	for i := range updates {
+		u := &updates[i]
+		switch {
+		case u.Status == RefStatusUpToDate || u.Status == RefStatusRejected:
+		case u.Name == rejected:
+			u.Status, u.Reason = RefStatusRejected, reason
+		case remotes == nil:
+			u.Status = RefStatusUnknown
+		case remotes[u.Name] == u.New:
+			// 远端已接受该ref的更新
+		case o.Atomic:
+			u.Status, u.Reason = RefStatusRejected, "atomic push failed"
+		case remotes[u.Name] == u.Old:
+			u.Status, u.Reason = RefStatusRejected, "not pushed"
+		default:
+			u.Status = RefStatusUnknown
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package gittools
+
+import (
+	"context"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPushWithOptions(t *testing.T) {
+	Convey("push with options", t, func() {
+		ctx := context.Background()
+		remote := newBareRemote(t)
+		g, r := newLocalRepository(t)
+		So(r.AddRemote(ctx, DefaultRemoteName, remote), ShouldBeNil)
+
+		updates, err := r.PushWithOptions(ctx, PushOptions{RefSpecs: []string{"refs/heads/master:refs/heads/master"}})
+		So(err, ShouldBeNil)
+		So(len(updates), ShouldEqual, 1)
+		So(updates[0].Status, ShouldEqual, RefStatusCreated)
+		So(updates[0].Old, ShouldBeEmpty)
+
+		other, err := g.Clone(ctx, remote, "")
+		So(err, ShouldBeNil)
+		defer func() { _ = other.RemoveAll() }()
+		So(other.RewriteFile(ctx, "other.txt", []byte("other")), ShouldBeNil)
+		So(other.Commit(ctx, "other"), ShouldBeNil)
+		updates, err = other.PushWithOptions(ctx, PushOptions{})
+		So(err, ShouldBeNil)
+		So(updates[0].Status, ShouldEqual, RefStatusUpdated)
+
+		So(r.RewriteFile(ctx, "mine.txt", []byte("mine")), ShouldBeNil)
+		So(r.Commit(ctx, "mine"), ShouldBeNil)
+		updates, err = r.PushWithOptions(ctx, PushOptions{})
+		So(err, ShouldNotBeNil)
+		So(updates[0].Status, ShouldEqual, RefStatusRejected)
+		So(updates[0].Reason, ShouldEqual, "non-fast-forward")
+
+		updates, err = r.PushWithOptions(ctx, PushOptions{Force: true, Atomic: true, Options: map[string]string{"ci.skip": ""}})
+		So(err, ShouldBeNil)
+		So(updates[0].Status, ShouldEqual, RefStatusForced)
+
+		So(other.RewriteFile(ctx, "other.txt", []byte("other again")), ShouldBeNil)
+		So(other.Commit(ctx, "other again"), ShouldBeNil)
+		updates, err = other.PushWithOptions(ctx, PushOptions{ForceWithLease: &Lease{}})
+		So(err, ShouldNotBeNil)
+		So(updates[0].Status, ShouldEqual, RefStatusRejected)
+
+		_, err = r.CreateBranch(ctx, "feature", "")
+		So(err, ShouldBeNil)
+		updates, err = r.PushWithOptions(ctx, PushOptions{RefSpecs: []string{"refs/heads/feature:refs/heads/feature"}})
+		So(err, ShouldBeNil)
+		So(updates[0].Status, ShouldEqual, RefStatusCreated)
+		updates, err = r.PushWithOptions(ctx, PushOptions{RefSpecs: []string{":refs/heads/feature"}})
+		So(err, ShouldBeNil)
+		So(updates[0].Status, ShouldEqual, RefStatusDeleted)
+	})
+}
+
+func TestPushRejectedByRemote(t *testing.T) {
+	Convey("refs rejected by remote", t, func() {
+		ctx := context.Background()
+		remote := newBareRemote(t)
+		// update hook仅拒绝refs/heads/protected*
+		hook := "#!/bin/sh\ncase \"$1\" in refs/heads/protected*) exit 1;; esac\n"
+		So(os.MkdirAll(filepath.Join(remote, "hooks"), 0755), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(remote, "hooks", "update"), []byte(hook), 0755), ShouldBeNil)
+		_, r := newLocalRepository(t)
+		So(r.AddRemote(ctx, DefaultRemoteName, remote), ShouldBeNil)
+		_, err := r.CreateBranch(ctx, "protected", "")
+		So(err, ShouldBeNil)
+
+		updates, err := r.PushWithOptions(ctx, PushOptions{RefSpecs: []string{"refs/heads/master:refs/heads/master", "refs/heads/protected:refs/heads/protected"}})
+		So(err, ShouldNotBeNil)
+		So(updates, ShouldHaveLength, 2)
+		So(updates[0].Status, ShouldEqual, RefStatusCreated)
+		So(updates[1].Status, ShouldEqual, RefStatusRejected)
+		So(updates[1].Reason, ShouldEqual, "hook declined")
+
+		// 仅第一个被拒绝的ref带有原因，其余远端未变化的ref同样标记为被拒绝
+		_, err = r.CreateBranch(ctx, "protected2", "")
+		So(err, ShouldBeNil)
+		updates, err = r.PushWithOptions(ctx, PushOptions{RefSpecs: []string{"refs/heads/protected:refs/heads/protected", "refs/heads/protected2:refs/heads/protected2"}})
+		So(err, ShouldNotBeNil)
+		So(updates, ShouldHaveLength, 2)
+		So(updates[0].Status, ShouldEqual, RefStatusRejected)
+		So(updates[0].Reason, ShouldEqual, "hook declined")
+		So(updates[1].Status, ShouldEqual, RefStatusRejected)
+		So(updates[1].Reason, ShouldEqual, "not pushed")
+	})
+}
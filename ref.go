@@ -4,6 +4,15 @@ import (
 	"github.com/go-git/go-git/v5/plumbing"
 )
 
+const (
+	branchRefPrefix = "refs/heads/"
+	tagRefPrefix    = "refs/tags/"
+)
+
+func getRemoteRefPrefix(remote string) string {
+	return plumbing.NewRemoteReferenceName(remote, "").String()
+}
+
 func getBranchReferenceName(branch string) plumbing.ReferenceName {
 	if plumbing.ReferenceName(branch).IsBranch() {
 		return plumbing.ReferenceName(branch)
@@ -11,11 +20,11 @@ func getBranchReferenceName(branch string) plumbing.ReferenceName {
 	return plumbing.NewBranchReferenceName(branch)
 }
 
-func getBranchRemoteReferenceName(branch string) plumbing.ReferenceName {
+func getBranchRemoteReferenceName(remote, branch string) plumbing.ReferenceName {
 	if plumbing.ReferenceName(branch).IsRemote() {
 		return plumbing.ReferenceName(branch)
 	}
-	return plumbing.NewRemoteReferenceName("origin", branch)
+	return plumbing.NewRemoteReferenceName(remote, branch)
 }
 
 func (r *repository) getBranchReferenceName(branch string) (plumbing.ReferenceName, error) {
@@ -0,0 +1,143 @@
+package gittools
+
+import (
+	"context"
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"sort"
+	"time"
+)
+
+// DefaultRemoteName 默认的remote名称
+const DefaultRemoteName = git.DefaultRemoteName
+
+// Remote 远程仓库信息
+type Remote struct {
+	// Name remote名称，如origin
+	Name string
+	// URLs remote地址，第一个地址用于fetch，push时会推送到所有地址
+	URLs []string
+}
+
+func getRemoteName(remote string) string {
+	if len(remote) == 0 {
+		return DefaultRemoteName
+	}
+	return remote
+}
+
+// authForURL 根据url的协议获取认证方式，仅ssh协议需要rsa认证
+func (h *cloner) authForURL(url string) (transport.AuthMethod, error) {
+	ep, err := transport.NewEndpoint(url)
+	if err != nil {
+		return nil, err
+	}
+	if ep.Protocol != "ssh" {
+		return nil, nil
+	}
+	publicKeys, err := h.auth()
+	if err != nil {
+		return nil, err
+	}
+	return publicKeys, nil
+}
+
+// remoteAuth 获取指定remote的认证方式
+func (r *repository) remoteAuth(remote string) (transport.AuthMethod, error) {
+	rm, err := r.Repository.Remote(getRemoteName(remote))
+	if err != nil {
+		return nil, err
+	}
+	if urls := rm.Config().URLs; len(urls) > 0 {
+		return r.h.authForURL(urls[0])
+	}
+	return nil, nil
+}
+
+// remoteURL remote的第一个url，remote为空则为origin，不存在时返回空
+func (r *repository) remoteURL(remote string) string {
+	defer r.lock()()
+	rm, err := r.Repository.Remote(getRemoteName(remote))
+	if err != nil || len(rm.Config().URLs) == 0 {
+		return ""
+	}
+	return rm.Config().URLs[0]
+}
+
+func (r *repository) Remotes(ctx context.Context) (remotes []Remote, err error) {
+	defer r.lock()()
+	defer func(start time.Time) { r.done(start, &err, "remotes") }(time.Now())
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	var rs []*git.Remote
+	if rs, err = r.Repository.Remotes(); err != nil {
+		return
+	}
+	for _, rm := range rs {
+		c := rm.Config()
+		remotes = append(remotes, Remote{Name: c.Name, URLs: append([]string(nil), c.URLs...)})
+	}
+	sort.Slice(remotes, func(i, j int) bool { return remotes[i].Name < remotes[j].Name })
+	return
+}
+
+func (r *repository) AddRemote(ctx context.Context, name string, urls ...string) (err error) {
+	defer r.lock()()
+	defer func(start time.Time) { r.done(start, &err, "add remote", Field{"name", name}, Field{"urls", urls}) }(time.Now())
+	defer r.acquire(ctx, &err)()
+	if err != nil {
+		return
+	}
+	_, err = r.Repository.CreateRemote(&config.RemoteConfig{Name: name, URLs: urls})
+	return
+}
+
+func (r *repository) RemoveRemote(ctx context.Context, name string) (err error) {
+	defer r.lock()()
+	defer func(start time.Time) { r.done(start, &err, "remove remote", Field{"name", name}) }(time.Now())
+	defer r.acquire(ctx, &err)()
+	if err != nil {
+		return
+	}
+	err = r.Repository.DeleteRemote(name)
+	return
+}
+
+func (r *repository) SetRemoteURL(ctx context.Context, name string, urls ...string) (err error) {
+	defer r.lock()()
+	defer func(start time.Time) { r.done(start, &err, "set remote url", Field{"name", name}, Field{"urls", urls}) }(time.Now())
+	defer r.acquire(ctx, &err)()
+	if err != nil {
+		return
+	}
+	var c *config.Config
+	if c, err = r.Config(); err != nil {
+		return
+	}
+	rc, ok := c.Remotes[name]
+	if !ok {
+		err = ErrRemoteNotFound
+		return
+	}
+	rc.URLs = urls
+	if err = rc.Validate(); err != nil {
+		return
+	}
+	err = r.SetConfig(c)
+	return
+}
+
+// listRemote 获取远端的所有ref，远端为空仓库时返回空
+func (r *repository) listRemote(ctx context.Context, rm *git.Remote, auth transport.AuthMethod) (refs []*plumbing.Reference, err error) {
+	err = r.h.retry(ctx, "list remote", func() (err0 error) {
+		refs, err0 = rm.ListContext(ctx, &git.ListOptions{Auth: auth})
+		return
+	})
+	if err == transport.ErrEmptyRemoteRepository {
+		err = nil
+	}
+	return
+}
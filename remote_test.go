@@ -0,0 +1,49 @@
+package gittools
+
+import (
+	"context"
+	"errors"
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestRemote(t *testing.T) {
+	Convey("upstream and fork remotes", t, func() {
+		ctx := context.Background()
+		g, upstream := newLocalRepository(t)
+		forkDir := newBareRemote(t)
+
+		r, err := g.Clone(ctx, upstream.Root(), "")
+		So(err, ShouldBeNil)
+		defer func() { _ = r.RemoveAll() }()
+
+		So(r.RemoveRemote(ctx, DefaultRemoteName), ShouldBeNil)
+		So(r.AddRemote(ctx, "upstream", upstream.Root()), ShouldBeNil)
+		So(r.AddRemote(ctx, "fork", "git@github.com:sandwich-go/gittools.git"), ShouldBeNil)
+		So(r.SetRemoteURL(ctx, "fork", forkDir), ShouldBeNil)
+		So(errors.Is(r.SetRemoteURL(ctx, "not_exists", forkDir), ErrRemoteNotFound), ShouldBeTrue)
+		remotes, err := r.Remotes(ctx)
+		So(err, ShouldBeNil)
+		So(remotes, ShouldResemble, []Remote{{Name: "fork", URLs: []string{forkDir}}, {Name: "upstream", URLs: []string{upstream.Root()}}})
+
+		So(upstream.RewriteFile(ctx, "b.txt", []byte("upstream")), ShouldBeNil)
+		So(upstream.Commit(ctx, "upstream commit"), ShouldBeNil)
+		sr, err := r.Fetch(ctx, "upstream")
+		So(err, ShouldBeNil)
+		So(sr.Status, ShouldEqual, SyncUpdated)
+		So(r.CheckoutBranch(ctx, "master", "upstream"), ShouldBeNil)
+		sr, err = r.Push(ctx, "fork")
+		So(err, ShouldBeNil)
+		So(sr.Status, ShouldEqual, SyncUpdated)
+
+		fork, err := git.PlainOpen(forkDir)
+		So(err, ShouldBeNil)
+		ref, err := fork.Reference(plumbing.Master, true)
+		So(err, ShouldBeNil)
+		local, err := r.(*repository).Reference(plumbing.Master, true)
+		So(err, ShouldBeNil)
+		So(ref.Hash(), ShouldEqual, local.Hash())
+	})
+}
@@ -9,46 +9,74 @@ import (
 	git "github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
 	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
-	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/transport"
 	"io"
 	"io/ioutil"
 	"os"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 )
 
+// repository 同一repository的操作通过mu串行执行，go-git的Repository以及headHash等状态均不是并发安全的
 type repository struct {
 	*git.Repository
+	mu             sync.Mutex
 	h              *cloner
 	headHash       plumbing.Hash
 	currentRefName plumbing.ReferenceName
+	sparsePaths    []string
+	lfs            billy.Filesystem
+	lockPath       string
 }
 
+// newRepository 优先使用仓库中保存的sparse checkout目录，没有则使用SparsePaths
 func newRepository(h *cloner, r *git.Repository) Repository {
-	repo := &repository{h: h, Repository: r}
+	sparsePaths := loadSparsePaths(r)
+	if len(sparsePaths) == 0 {
+		sparsePaths = normalizeSparsePaths(h.GetSparsePaths())
+	}
+	repo := &repository{h: h, Repository: r, sparsePaths: sparsePaths}
 	_ = repo.updateHeadHash()
 	return repo
 }
 
+// lock 加锁并返回解锁函数，用法为defer r.lock()()
+func (r *repository) lock() func() {
+	r.mu.Lock()
+	return r.mu.Unlock
+}
+
 func (r *repository) cleanWorkTree() (*git.Worktree, error) {
 	worktree, err := r.Repository.Worktree()
 	if err != nil {
 		return nil, err
 	}
 	var is bool
-	is, err = r.IsClean()
+	if is, err = r.isClean(); err != nil {
+		return nil, err
+	}
 	if !is {
-		return nil, fmt.Errorf("current worktree not clean")
+		return nil, ErrDirtyWorktree
 	}
 	return worktree, nil
 }
 
 func (r *repository) IsClean() (bool, error) {
+	defer r.lock()()
+	return r.isClean()
+}
+
+func (r *repository) isClean() (bool, error) {
 	worktree, err := r.Repository.Worktree()
 	if err != nil {
 		return false, err
 	}
-	status, err0 := worktree.Status()
+	status, err0 := r.status(worktree)
 	if err0 != nil {
 		return false, err0
 	}
@@ -64,6 +92,11 @@ func (r *repository) IsClean() (bool, error) {
 }
 
 func (r *repository) UserName() string {
+	defer r.lock()()
+	return r.userName()
+}
+
+func (r *repository) userName() string {
 	c, _ := r.Config()
 	if c == nil {
 		return ""
@@ -72,6 +105,11 @@ func (r *repository) UserName() string {
 }
 
 func (r *repository) UserEmail() string {
+	defer r.lock()()
+	return r.userEmail()
+}
+
+func (r *repository) userEmail() string {
 	c, _ := r.Config()
 	if c == nil {
 		return ""
@@ -80,23 +118,37 @@ func (r *repository) UserEmail() string {
 }
 
 func (r *repository) Root() string {
+	defer r.lock()()
+	return r.root()
+}
+
+func (r *repository) root() string {
 	wt, _ := r.Worktree()
 	if wt == nil || wt.Filesystem == nil {
+		// bare仓库没有工作区，使用存储的根目录
+		if fs, ok := r.Storer.(interface{ Filesystem() billy.Filesystem }); ok {
+			return fs.Filesystem().Root()
+		}
 		return ""
 	}
 	return wt.Filesystem.Root()
 }
 
 func (r *repository) RemoveAll() error {
-	return os.RemoveAll(r.Root())
+	defer r.lock()()
+	return os.RemoveAll(r.root())
 }
 
-func (r *repository) print(err error, v ...interface{}) {
-	if r.currentRefName.IsTag() {
-		r.h.print(err, append(v, fmt.Sprintf("tag: %s,", r.currentRefName.Short()), fmt.Sprintf("hash: %s,", r.headHash))...)
-	} else {
-		r.h.print(err, append(v, fmt.Sprintf("branch: %s,", r.currentRefName.Short()), fmt.Sprintf("hash: %s,", r.headHash))...)
-	}
+// ref 当前的ref，如refs/heads/master
+func (r *repository) ref() string {
+	defer r.lock()()
+	return r.currentRefName.String()
+}
+
+// hash 当前HEAD的commit hash
+func (r *repository) hash() string {
+	defer r.lock()()
+	return r.headHash.String()
 }
 
 func (r *repository) updateHeadHash() error {
@@ -109,39 +161,107 @@ func (r *repository) updateHeadHash() error {
 	return nil
 }
 
-func (r *repository) checkout(ref plumbing.ReferenceName) (err error) {
-	defer func() { r.print(err, fmt.Sprintf("checkout, want: %s,", ref.String())) }()
+func (r *repository) checkout(ctx context.Context, ref plumbing.ReferenceName) (err error) {
+	defer func(start time.Time) { r.done(start, &err, "checkout", Field{"want", ref}) }(time.Now())
+	defer r.acquire(ctx, &err)()
+	if err != nil {
+		return
+	}
 	var workTree *git.Worktree
 	workTree, err = r.cleanWorkTree()
 	if err != nil {
 		return
 	}
+	if err = r.fetchMissingBlobs(ctx, plumbing.Revision(ref)); err != nil {
+		return
+	}
+	// 工作区已确认干净，未checkout的sparse文件以及已下载的LFS文件在go-git看来是被修改的，仅此时需要强制checkout
+	force := len(r.sparsePaths) > 0
+	if !force {
+		if force, err = r.lfsDownloaded(ctx); err != nil {
+			return
+		}
+	}
 	if err = workTree.Checkout(&git.CheckoutOptions{
-		Branch: ref,
-	}); err != nil {
+		Branch:                    ref,
+		Force:                     force,
+		SparseCheckoutDirectories: r.sparsePaths,
+	}); err == nil && len(r.sparsePaths) > 0 {
+		err = r.clearSkipWorktree()
+	}
+	if err != nil {
 		return
 	}
-	err = r.updateHeadHash()
+	if err = r.updateHeadHash(); err != nil {
+		return
+	}
+	err = r.afterCheckout(ctx)
 	return
 }
 
-func (r *repository) Pull(ctx context.Context) (err error) {
-	defer func() { r.print(err, "pull,") }()
-	var publicKeys *ssh.PublicKeys
-	if publicKeys, err = r.h.auth(); err != nil {
+// afterCheckout checkout后按照配置下载LFS对象以及更新submodule
+func (r *repository) afterCheckout(ctx context.Context) error {
+	if r.h.GetLFS() {
+		if err := r.lfsPull(ctx); err != nil {
+			return err
+		}
+	}
+	return r.recurseSubmodules(ctx)
+}
+
+func (r *repository) Pull(ctx context.Context, remote string) (sr *SyncResult, err error) {
+	defer r.lock()()
+	defer func(start time.Time) { r.done(start, &err, "pull", Field{"remote", getRemoteName(remote)}) }(time.Now())
+	defer r.acquire(ctx, &err)()
+	if err != nil {
+		return
+	}
+	ctx, cancel := withTimeout(ctx, r.h.GetFetchTimeout())
+	defer cancel()
+	var auth transport.AuthMethod
+	if auth, err = r.remoteAuth(remote); err != nil {
 		return
 	}
 	var workTree *git.Worktree
 	if workTree, err = r.cleanWorkTree(); err != nil {
-		return err
+		return
+	}
+	var head *plumbing.Reference
+	if head, err = r.Head(); err != nil {
+		return
 	}
-	err = workTree.PullContext(ctx, &git.PullOptions{
-		Depth:    r.h.GetDepth(),
-		Auth:     publicKeys,
-		Progress: r.h.getProgress(),
+	err = r.h.retry(ctx, "pull", func() error {
+		return workTree.PullContext(r.h.metered(ctx, "pull"), &git.PullOptions{
+			RemoteName: getRemoteName(remote),
+			Depth:      r.h.GetDepth(),
+			Auth:       auth,
+			Progress:   r.h.progress(ctx, "pull"),
+		})
 	})
-	if err = checkErr(err); err == nil {
-		err = r.updateHeadHash()
+	if err == ErrUnstagedChanges {
+		// go-git已更新HEAD，但将未checkout的sparse文件以及已下载的LFS文件视为未暂存的修改而拒绝reset，工作区已确认干净，重新reset
+		var newHead *plumbing.Reference
+		if newHead, err = r.Head(); err == nil {
+			err = r.resetSparse(ctx, workTree, newHead.Hash())
+		}
+	}
+	old := hashString(head.Hash())
+	switch err {
+	case nil:
+		if err = r.updateHeadHash(); err == nil {
+			err = r.afterCheckout(ctx)
+		}
+		if err == nil {
+			sr = &SyncResult{Status: SyncUpdated, Old: old, New: hashString(r.headHash), Refs: []RefUpdate{{
+				Name: head.Name().String(), Old: old, New: hashString(r.headHash), Status: RefStatusUpdated,
+			}}}
+		}
+	case NoErrAlreadyUpToDate:
+		sr, err = &SyncResult{Status: SyncUpToDate, Old: old, New: old}, nil
+	case ErrNonFastForwardUpdate:
+		sr = &SyncResult{Status: SyncDiverged, Old: old, New: old, Refs: []RefUpdate{{
+			Name: head.Name().String(), Old: old, New: old, Status: RefStatusRejected, Reason: err.Error(),
+		}}}
 	}
 	return
 }
@@ -151,8 +271,8 @@ const (
 	commentPrefix = "#"
 )
 
-func (r *repository) isIgnore(_ context.Context, fileOrDir []string, isDir bool) (is bool, err error) {
-	defer func() { r.print(err, fmt.Sprintf("is ignore fileOrDir: %v, isDir: %v", fileOrDir, isDir)) }()
+func (r *repository) isIgnore(ctx context.Context, fileOrDir []string, isDir bool) (is bool, err error) {
+	defer func(start time.Time) { r.done(start, &err, "is ignore", Field{"path", fileOrDir}, Field{"dir", isDir}) }(time.Now())
 	var workTree *git.Worktree
 	if workTree, err = r.Worktree(); err != nil {
 		return
@@ -161,7 +281,9 @@ func (r *repository) isIgnore(_ context.Context, fileOrDir []string, isDir bool)
 	ps, _ = gitignore.LoadGlobalPatterns(workTree.Filesystem)
 	ps1, _ = gitignore.LoadSystemPatterns(workTree.Filesystem)
 	ps = append(ps, ps1...)
-	ps1, _ = gitignore.ReadPatterns(workTree.Filesystem, nil)
+	if ps1, err = readIgnorePatterns(ctx, workTree.Filesystem, nil); err != nil {
+		return
+	}
 	ps = append(ps, ps1...)
 
 	for _, i := range ps {
@@ -172,16 +294,79 @@ func (r *repository) isIgnore(_ context.Context, fileOrDir []string, isDir bool)
 	return false, err
 }
 
+// readIgnoreFile 读取dir下的.gitignore，dir为空时同时读取.git/info/exclude
+func readIgnoreFile(fs billy.Filesystem, dir []string) ([]gitignore.Pattern, error) {
+	var ps []gitignore.Pattern
+	files := []string{fs.Join(append(dir, ignoreFile)...)}
+	if len(dir) == 0 {
+		files = append([]string{fs.Join(git.GitDirName, "info", "exclude")}, files...)
+	}
+	for _, name := range files {
+		f, err := fs.Open(name)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			s := scanner.Text()
+			if !strings.HasPrefix(s, commentPrefix) && len(strings.TrimSpace(s)) > 0 {
+				ps = append(ps, gitignore.ParsePattern(s, dir))
+			}
+		}
+		_ = f.Close()
+	}
+	return ps, nil
+}
+
+// readIgnorePatterns 与gitignore.ReadPatterns一致，递归读取工作区中的.gitignore，遍历时响应ctx的取消
+func readIgnorePatterns(ctx context.Context, fs billy.Filesystem, dir []string) ([]gitignore.Pattern, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ps, err := readIgnoreFile(fs, dir)
+	if err != nil {
+		return nil, err
+	}
+	var fis []os.FileInfo
+	if fis, err = fs.ReadDir(fs.Join(dir...)); err != nil {
+		return nil, err
+	}
+	for _, fi := range fis {
+		if !fi.IsDir() || fi.Name() == git.GitDirName {
+			continue
+		}
+		sub := append(append([]string(nil), dir...), fi.Name())
+		if gitignore.NewMatcher(ps).Match(sub, true) {
+			continue
+		}
+		var subps []gitignore.Pattern
+		if subps, err = readIgnorePatterns(ctx, fs, sub); err != nil {
+			return nil, err
+		}
+		ps = append(ps, subps...)
+	}
+	return ps, nil
+}
+
 func (r *repository) IsIgnoreDir(ctx context.Context, dirs ...string) (bool, error) {
+	defer r.lock()()
 	return r.isIgnore(ctx, dirs, true)
 }
 
 func (r *repository) IsIgnoreFile(ctx context.Context, files ...string) (bool, error) {
+	defer r.lock()()
 	return r.isIgnore(ctx, files, false)
 }
 
-func (r *repository) Ignore(_ context.Context, patterns ...string) (err error) {
-	defer func() { r.print(err, fmt.Sprintf("ignore pattern: %v", patterns)) }()
+func (r *repository) Ignore(ctx context.Context, patterns ...string) (err error) {
+	defer r.lock()()
+	defer func(start time.Time) { r.done(start, &err, "ignore", Field{"patterns", patterns}) }(time.Now())
+	defer r.acquire(ctx, &err)()
+	if err != nil {
+		return
+	}
 	var workTree *git.Worktree
 	if workTree, err = r.Worktree(); err != nil {
 		return err
@@ -229,23 +414,43 @@ func (r *repository) Ignore(_ context.Context, patterns ...string) (err error) {
 	return
 }
 
-func (r *repository) Add(_ context.Context, fileOrDirs ...string) (err error) {
-	defer func() { r.print(err, fmt.Sprintf("add file/dir: %v", fileOrDirs)) }()
+func (r *repository) Add(ctx context.Context, fileOrDirs ...string) (err error) {
+	defer r.lock()()
+	defer func(start time.Time) { r.done(start, &err, "add", Field{"paths", fileOrDirs}) }(time.Now())
+	defer r.acquire(ctx, &err)()
+	if err != nil {
+		return
+	}
 	var workTree *git.Worktree
 	if workTree, err = r.Worktree(); err != nil {
 		return err
 	}
 	for _, f := range fileOrDirs {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		if !r.inSparsePaths(f) {
+			err = fmt.Errorf("%w: %s", ErrOutsideSparsePaths, f)
+			break
+		}
 		_, err = workTree.Add(f)
 		if err != nil {
 			break
 		}
 	}
+	if err == nil {
+		err = r.cleanLFS()
+	}
 	return
 }
 
-func (r *repository) AddAll(_ context.Context, excludes ...string) (err error) {
-	defer func() { r.print(err, fmt.Sprintf("add all, excludes: %v", excludes)) }()
+func (r *repository) AddAll(ctx context.Context, excludes ...string) (err error) {
+	defer r.lock()()
+	defer func(start time.Time) { r.done(start, &err, "add all", Field{"excludes", excludes}) }(time.Now())
+	defer r.acquire(ctx, &err)()
+	if err != nil {
+		return
+	}
 	var workTree *git.Worktree
 	if workTree, err = r.Worktree(); err != nil {
 		return err
@@ -254,12 +459,106 @@ func (r *repository) AddAll(_ context.Context, excludes ...string) (err error) {
 	for _, v := range excludes {
 		workTree.Excludes = append(workTree.Excludes, gitignore.ParsePattern(v, nil))
 	}
-	err = workTree.AddWithOptions(&git.AddOptions{All: true})
+	if err = r.keepSparseEntries(func() error { return r.addAll(ctx, workTree) }); err == nil {
+		err = r.cleanLFS()
+	}
 	return
 }
 
-func (r *repository) RewriteFile(_ context.Context, file string, data []byte) (err error) {
-	defer func() { r.print(err, "rewrite file,") }()
+// addAll 等同于git add -A，逐个文件写入对象存储后一次性更新index，ctx取消时index保持不变
+func (r *repository) addAll(ctx context.Context, workTree *git.Worktree) error {
+	status, err := workTree.Status()
+	if err != nil {
+		return err
+	}
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(status))
+	for name, s := range status {
+		if s.Worktree != git.Unmodified {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		if status[name].Worktree == git.Deleted {
+			_, _ = idx.Remove(name)
+			continue
+		}
+		if err = r.addToIndex(workTree.Filesystem, idx, name); err != nil {
+			return err
+		}
+	}
+	return r.Storer.SetIndex(idx)
+}
+
+// addToIndex 将工作区中的文件写入对象存储并更新index中对应的条目
+func (r *repository) addToIndex(fs billy.Filesystem, idx *index.Index, name string) error {
+	fi, err := fs.Lstat(name)
+	if err != nil {
+		return err
+	}
+	mode, err := filemode.NewFromOSFileMode(fi.Mode())
+	if err != nil {
+		return err
+	}
+	obj := r.Storer.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	w, err := obj.Writer()
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		var target string
+		if target, err = fs.Readlink(name); err == nil {
+			_, err = w.Write([]byte(target))
+		}
+	} else {
+		var f billy.File
+		if f, err = fs.Open(name); err == nil {
+			_, err = io.Copy(w, f)
+			_ = f.Close()
+		}
+	}
+	if err0 := w.Close(); err == nil {
+		err = err0
+	}
+	if err != nil {
+		return err
+	}
+	hash, err := r.Storer.SetEncodedObject(obj)
+	if err != nil {
+		return err
+	}
+	e, err := idx.Entry(name)
+	if err == index.ErrEntryNotFound {
+		e = idx.Add(name)
+	} else if err != nil {
+		return err
+	}
+	e.Hash = hash
+	e.Mode = mode
+	e.ModifiedAt = fi.ModTime()
+	e.Size = uint32(fi.Size())
+	return nil
+}
+
+func (r *repository) RewriteFile(ctx context.Context, file string, data []byte) (err error) {
+	defer r.lock()()
+	defer func(start time.Time) { r.done(start, &err, "rewrite file", Field{"path", file}) }(time.Now())
+	defer r.acquire(ctx, &err)()
+	if err != nil {
+		return
+	}
+	if !r.inSparsePaths(file) {
+		err = fmt.Errorf("%w: %s", ErrOutsideSparsePaths, file)
+		return
+	}
 	var workTree *git.Worktree
 	if workTree, err = r.Worktree(); err != nil {
 		return err
@@ -272,65 +571,92 @@ func (r *repository) RewriteFile(_ context.Context, file string, data []byte) (e
 	if _, err = f.Write(data); err == nil {
 		_, err = workTree.Add(file)
 	}
+	if err == nil {
+		err = r.cleanLFS()
+	}
 	return
 }
 
-func (r *repository) Commit(_ context.Context, comment string) (err error) {
-	defer func() { r.print(err, fmt.Sprintf("commit, comment: %s", comment)) }()
+func (r *repository) Commit(ctx context.Context, comment string) (err error) {
+	defer r.lock()()
+	defer func(start time.Time) { r.done(start, &err, "commit", Field{"comment", comment}) }(time.Now())
+	defer r.acquire(ctx, &err)()
+	if err != nil {
+		return
+	}
 	var workTree *git.Worktree
 	if workTree, err = r.Worktree(); err != nil {
 		return err
 	}
 	var status git.Status
-	if status, err = workTree.Status(); err != nil {
+	if status, err = r.status(workTree); err != nil {
 		return err
 	}
 	if status.IsClean() {
 		return nil
 	}
-	if _, err = workTree.Commit(comment, &git.CommitOptions{}); err != nil {
+	var message string
+	if message, err = r.commitMessage(comment); err != nil {
+		return err
+	}
+	var hash plumbing.Hash
+	if hash, err = workTree.Commit(message, &git.CommitOptions{}); err != nil {
 		return err
 	}
+	if r.h.GetSigner() != nil {
+		if _, err = r.signCommit(hash); err != nil {
+			return err
+		}
+	}
 	err = r.updateHeadHash()
 	return
 }
 
-func (r *repository) Push(ctx context.Context) (err error) {
-	defer func() { r.print(err, "push,") }()
-	var publicKeys *ssh.PublicKeys
-	if publicKeys, err = r.h.auth(); err != nil {
-		return
+func (r *repository) Push(ctx context.Context, remote string) (sr *SyncResult, err error) {
+	defer r.lock()()
+	defer func(start time.Time) { r.done(start, &err, "push", Field{"remote", getRemoteName(remote)}) }(time.Now())
+	var refs []RefUpdate
+	refs, err = r.pushWithOptions(ctx, PushOptions{Remote: remote})
+	if err == nil || len(refs) > 0 {
+		sr = newSyncResult(r.currentRefName, refs)
 	}
-	err = r.Repository.PushContext(ctx, &git.PushOptions{
-		Auth:     publicKeys,
-		Progress: r.h.getProgress(),
-	})
-	err = checkErr(err)
 	return
 }
 
-func (r *repository) CheckoutBranch(_ context.Context, branch string) error {
+func (r *repository) CheckoutBranch(ctx context.Context, branch, remote string) error {
+	defer r.lock()()
 	if len(branch) == 0 {
-		return r.checkout(plumbing.Master)
+		return r.checkout(ctx, plumbing.Master)
 	}
-	return r.checkout(getBranchRemoteReferenceName(branch))
+	return r.checkout(ctx, getBranchRemoteReferenceName(getRemoteName(remote), branch))
 }
 
-func (r *repository) Branch(_ context.Context, branch string) (bc Branch, err error) {
-	defer func() { r.print(err, fmt.Sprintf("branch, name: %s", branch)) }()
-	var brn plumbing.ReferenceName
-	brn, err = r.getBranchReferenceName(branch)
-	if err != nil {
+func (r *repository) Branch(ctx context.Context, branch string) (bc Branch, err error) {
+	defer r.lock()()
+	defer func(start time.Time) { r.done(start, &err, "branch", Field{"name", branch}) }(time.Now())
+	if err = ctx.Err(); err != nil {
 		return
 	}
-	var b *config.Branch
-	b, err = r.Repository.Branch(brn.Short())
-	if err == nil {
-		bc = newBranch(r, b)
+	if b, err0 := r.findBranch(branch); err0 != nil {
+		err = err0
+	} else {
+		bc = b
 	}
 	return
 }
 
+func (r *repository) findBranch(name string) (*branch, error) {
+	brn, err := r.getBranchReferenceName(name)
+	if err != nil {
+		return nil, err
+	}
+	var b *config.Branch
+	if b, err = r.Repository.Branch(brn.Short()); err != nil {
+		return nil, err
+	}
+	return newBranch(r, b), nil
+}
+
 func (r *repository) getHash(hash string) (plumbing.Hash, error) {
 	var hh plumbing.Hash
 	if len(hash) == 0 {
@@ -346,7 +672,12 @@ func (r *repository) getHash(hash string) (plumbing.Hash, error) {
 }
 
 func (r *repository) CreateBranch(ctx context.Context, branch string, hash string) (bc Branch, err error) {
-	defer func() { r.print(err, fmt.Sprintf("create branch, name: %s", branch)) }()
+	defer r.lock()()
+	defer func(start time.Time) { r.done(start, &err, "create branch", Field{"name", branch}) }(time.Now())
+	defer r.acquire(ctx, &err)()
+	if err != nil {
+		return
+	}
 	var brn plumbing.ReferenceName
 	brn, err = r.getBranchReferenceName(branch)
 	if err != nil {
@@ -364,27 +695,42 @@ func (r *repository) CreateBranch(ctx context.Context, branch string, hash strin
 	}
 	err = r.Storer.SetReference(plumbing.NewHashReference(brn, hh))
 	if err == nil {
-		bc, err = r.Branch(ctx, brn.Short())
+		if b, err0 := r.findBranch(brn.Short()); err0 != nil {
+			err = err0
+		} else {
+			bc = b
+		}
 	}
 	return
 }
 
 func (r *repository) DeleteLocalBranch(ctx context.Context, branch string) (err error) {
-	defer func() { r.print(err, fmt.Sprintf("delete local branch, name: %s", branch)) }()
+	defer r.lock()()
+	defer func(start time.Time) { r.done(start, &err, "delete local branch", Field{"name", branch}) }(time.Now())
+	defer r.acquire(ctx, &err)()
+	if err != nil {
+		return
+	}
 	var brn plumbing.ReferenceName
 	brn, err = r.getBranchReferenceName(branch)
 	if err != nil {
 		return
 	}
-	var bc Branch
-	if bc, err = r.Branch(ctx, brn.Short()); err == nil {
-		err = bc.Delete(ctx)
+	if b, err0 := r.findBranch(brn.Short()); err0 != nil {
+		err = err0
+	} else {
+		err = b.deleteLocal(ctx)
 	}
 	return
 }
 
 func (r *repository) DeleteBranch(ctx context.Context, branch string) (err error) {
-	defer func() { r.print(err, fmt.Sprintf("delete branch, name: %s", branch)) }()
+	defer r.lock()()
+	defer func(start time.Time) { r.done(start, &err, "delete branch", Field{"name", branch}) }(time.Now())
+	defer r.acquire(ctx, &err)()
+	if err != nil {
+		return
+	}
 	var brn plumbing.ReferenceName
 	brn, err = r.getBranchReferenceName(branch)
 	if err != nil {
@@ -394,35 +740,54 @@ func (r *repository) DeleteBranch(ctx context.Context, branch string) (err error
 		Name:  brn.Short(),
 		Merge: brn,
 	})
-	_ = bc.Delete(ctx)
-	err = bc.Push(ctx)
+	_ = bc.delete(ctx)
+	err = bc.push(ctx)
 	return
 }
 
-func (r *repository) CheckoutTag(_ context.Context, tag string) error {
+func (r *repository) CheckoutTag(ctx context.Context, tag string) error {
+	defer r.lock()()
 	if len(tag) == 0 {
-		return r.checkout(plumbing.Master)
+		return r.checkout(ctx, plumbing.Master)
 	}
-	return r.checkout(getTagReferenceName(tag))
+	return r.checkout(ctx, getTagReferenceName(tag))
 }
 
-func (r *repository) Tag(_ context.Context, tag string) (t Tag, err error) {
-	defer func() { r.print(err, fmt.Sprintf("tag, name: %s", tag)) }()
-	var trn plumbing.ReferenceName
-	trn, err = r.getTagReferenceName(tag)
-	if err != nil {
+func (r *repository) Tag(ctx context.Context, tag string) (t Tag, err error) {
+	defer r.lock()()
+	defer func(start time.Time) { r.done(start, &err, "tag", Field{"name", tag}) }(time.Now())
+	if err = ctx.Err(); err != nil {
 		return
 	}
-	var ref *plumbing.Reference
-	ref, err = r.Repository.Tag(trn.Short())
-	if err == nil {
-		t = newTag(r, ref)
+	if tg, err0 := r.findTag(tag); err0 != nil {
+		err = err0
+	} else {
+		t = tg
 	}
 	return
 }
 
-func (r *repository) CreateTag(_ context.Context, tag, comment, hash string) (t Tag, err error) {
-	defer func() { r.print(err, fmt.Sprintf("create tag, name: %s, comment:%s", tag, comment)) }()
+func (r *repository) findTag(name string) (*tag, error) {
+	trn, err := r.getTagReferenceName(name)
+	if err != nil {
+		return nil, err
+	}
+	var ref *plumbing.Reference
+	if ref, err = r.Repository.Tag(trn.Short()); err != nil {
+		return nil, err
+	}
+	return newTag(r, ref), nil
+}
+
+func (r *repository) CreateTag(ctx context.Context, tag, comment, hash string) (t Tag, err error) {
+	defer r.lock()()
+	defer func(start time.Time) {
+		r.done(start, &err, "create tag", Field{"name", tag}, Field{"comment", comment})
+	}(time.Now())
+	defer r.acquire(ctx, &err)()
+	if err != nil {
+		return
+	}
 	var trn plumbing.ReferenceName
 	trn, err = r.getTagReferenceName(tag)
 	if err != nil {
@@ -435,6 +800,9 @@ func (r *repository) CreateTag(_ context.Context, tag, comment, hash string) (t
 	}
 	var ref *plumbing.Reference
 	ref, err = r.Repository.CreateTag(trn.Short(), hh, &git.CreateTagOptions{Message: comment})
+	if err == nil && r.h.GetSigner() != nil {
+		ref, err = r.signTag(ref)
+	}
 	if err == nil {
 		t = newTag(r, ref)
 	}
@@ -442,42 +810,45 @@ func (r *repository) CreateTag(_ context.Context, tag, comment, hash string) (t
 }
 
 func (r *repository) DeleteLocalTag(ctx context.Context, tag string) (err error) {
-	defer func() { r.print(err, fmt.Sprintf("delete local tag, name: %s", tag)) }()
+	defer r.lock()()
+	defer func(start time.Time) { r.done(start, &err, "delete local tag", Field{"name", tag}) }(time.Now())
+	defer r.acquire(ctx, &err)()
+	if err != nil {
+		return
+	}
 	var trn plumbing.ReferenceName
 	trn, err = r.getTagReferenceName(tag)
 	if err != nil {
 		return
 	}
-	var t Tag
-	if t, err = r.Tag(ctx, trn.Short()); err == nil {
-		err = t.Delete(ctx)
+	if t, err0 := r.findTag(trn.Short()); err0 != nil {
+		err = err0
+	} else {
+		err = t.deleteLocal(ctx)
 	}
 	return
 }
 
 func (r *repository) DeleteTag(ctx context.Context, tag string) (err error) {
-	defer func() { r.print(err, fmt.Sprintf("delete tag, name: %s", tag)) }()
+	defer r.lock()()
+	defer func(start time.Time) { r.done(start, &err, "delete tag", Field{"name", tag}) }(time.Now())
+	defer r.acquire(ctx, &err)()
+	if err != nil {
+		return
+	}
 	var trn plumbing.ReferenceName
 	trn, err = r.getTagReferenceName(tag)
 	if err != nil {
 		return
 	}
 	t := newTag(r, plumbing.NewHashReference(trn, plumbing.ZeroHash))
-	_ = t.Delete(ctx)
-	err = t.Push(ctx)
+	_ = t.delete(ctx)
+	err = t.push(ctx)
 	return
 }
 
-func (r *repository) Fetch(ctx context.Context) (err error) {
-	defer func() { r.print(err, "fetch,") }()
-	var publicKeys *ssh.PublicKeys
-	if publicKeys, err = r.h.auth(); err != nil {
-		return
-	}
-	err = checkErr(r.Repository.FetchContext(ctx, &git.FetchOptions{
-		Auth:     publicKeys,
-		Progress: r.h.getProgress(),
-		Depth:    r.h.GetDepth(),
-	}))
-	return
+func (r *repository) Fetch(ctx context.Context, remote string) (sr *SyncResult, err error) {
+	defer r.lock()()
+	defer func(start time.Time) { r.done(start, &err, "fetch", Field{"remote", getRemoteName(remote)}) }(time.Now())
+	return r.fetchWithOptions(ctx, FetchOptions{Remote: remote})
 }
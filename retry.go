@@ -0,0 +1,143 @@
+package gittools
+
+import (
+	"context"
+	"errors"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy 网络操作(clone、fetch、pull、push、LFS传输等)的重试策略
+type RetryPolicy struct {
+	// MaxAttempts 最大尝试次数，包括第一次，小于等于1则不重试
+	MaxAttempts int
+	// InitialBackoff 第一次重试前的等待时间
+	InitialBackoff time.Duration
+	// MaxBackoff 等待时间的上限，为0则不限制
+	MaxBackoff time.Duration
+	// Multiplier 每次重试后等待时间的倍数，小于1时视为1
+	Multiplier float64
+	// Jitter 等待时间的随机抖动比例，取值0~1，如0.2表示在[0.8, 1.2]倍之间随机
+	Jitter float64
+	// Retryable 判断错误是否可以重试，为nil则仅重试临时性的网络错误，如连接被重置、超时、HTTP 429以及5xx
+	Retryable func(err error) bool
+}
+
+// DefaultRetryPolicy 默认的重试策略，最多尝试3次，等待时间从500ms开始指数增长
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     10 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+}
+
+// backoff 第attempt次失败后的等待时间，attempt从1开始
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	d := float64(p.InitialBackoff)
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	for i := 1; i < attempt; i++ {
+		d *= multiplier
+		if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d *= 1 + p.Jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(d)
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return isTransientError(err)
+}
+
+// transientMessages 无法通过类型判断时，通过错误信息识别的临时性网络错误，如ssh传输返回的错误
+var transientMessages = []string{
+	"connection reset by peer",
+	"connection refused",
+	"broken pipe",
+	"i/o timeout",
+	"tls handshake timeout",
+	"unexpected eof",
+	"no route to host",
+	"network is unreachable",
+	"temporary failure in name resolution",
+}
+
+// isTransientError 错误是否是临时性的网络错误，如连接被重置、超时、HTTP 429以及5xx，RetryPolicy默认仅重试这些错误
+func isTransientError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	if status := httpStatus(err); status > 0 {
+		return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+	}
+	return containsAny(err, transientMessages)
+}
+
+// httpStatus 错误对应的HTTP状态码，非HTTP错误返回0
+func httpStatus(err error) int {
+	var gitErr *githttp.Err
+	if errors.As(err, &gitErr) && gitErr.Response != nil {
+		return gitErr.Response.StatusCode
+	}
+	var lfsErr *lfsHTTPError
+	if errors.As(err, &lfsErr) {
+		return lfsErr.StatusCode
+	}
+	return 0
+}
+
+// withTimeout d大于0时返回带超时的ctx，否则原样返回ctx
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// retry 按照RetryPolicy执行f，每次失败都会输出Warn级别的日志
+func (h *cloner) retry(ctx context.Context, op string, f func() error) error {
+	p := h.GetRetryPolicy()
+	if p == nil || p.MaxAttempts <= 1 {
+		return f()
+	}
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil || attempt >= p.MaxAttempts || !p.retryable(err) {
+			return err
+		}
+		d := p.backoff(attempt)
+		h.emit(LevelWarn, "retry", Field{FieldOp, op}, Field{"attempt", attempt}, Field{"max_attempts", p.MaxAttempts}, Field{"backoff", d}, Field{FieldError, err})
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(d):
+		}
+	}
+}
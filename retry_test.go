@@ -0,0 +1,66 @@
+package gittools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	Convey("retry", t, func() {
+		Convey("retryable error", func() {
+			for err, retryable := range map[error]bool{
+				fmt.Errorf("fetch: %w", syscall.ECONNRESET):                         true,
+				errors.New("ssh: handshake failed: read: connection reset by peer"): true,
+				&githttp.Err{Response: &http.Response{StatusCode: 502}}:             true,
+				&githttp.Err{Response: &http.Response{StatusCode: 429}}:             true,
+				&lfsHTTPError{StatusCode: 500}:                                      true,
+				&lfsHTTPError{StatusCode: 400}:                                      false,
+				transport.ErrRepositoryNotFound:                                     false,
+				context.Canceled:                                                    false,
+				NoErrAlreadyUpToDate:                                                false,
+			} {
+				So(isTransientError(err), ShouldEqual, retryable)
+			}
+		})
+
+		Convey("backoff", func() {
+			p := &RetryPolicy{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 30 * time.Millisecond, Multiplier: 2}
+			So(p.backoff(1), ShouldEqual, 10*time.Millisecond)
+			So(p.backoff(2), ShouldEqual, 20*time.Millisecond)
+			So(p.backoff(3), ShouldEqual, 30*time.Millisecond)
+			p.Jitter = 0.5
+			for i := 0; i < 10; i++ {
+				So(p.backoff(1), ShouldBeBetweenOrEqual, 5*time.Millisecond, 15*time.Millisecond)
+			}
+		})
+
+		Convey("attempts", func() {
+			h := New(WithRetryPolicy(&RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond})).(*cloner)
+			ctx := context.Background()
+			calls := 0
+			flaky := func(failures int, err error) func() error {
+				calls = 0
+				return func() error {
+					if calls++; calls <= failures {
+						return err
+					}
+					return nil
+				}
+			}
+			So(h.retry(ctx, "test", flaky(2, syscall.ECONNRESET)), ShouldBeNil)
+			So(calls, ShouldEqual, 3)
+			So(h.retry(ctx, "test", flaky(3, syscall.ECONNRESET)), ShouldEqual, syscall.ECONNRESET)
+			So(calls, ShouldEqual, 3)
+			So(h.retry(ctx, "test", flaky(1, transport.ErrAuthenticationRequired)), ShouldEqual, transport.ErrAuthenticationRequired)
+			So(calls, ShouldEqual, 1)
+		})
+	})
+}
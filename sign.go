@@ -0,0 +1,340 @@
+package gittools
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotSigned commit或者tag未签名
+	ErrNotSigned = errors.New("object not signed")
+	// ErrSignerNotAllowed 签名者不在允许的公钥中
+	ErrSignerNotAllowed = errors.New("signer not allowed")
+	// ErrSigningKeyNotFound armored私钥中没有OpenPGP私钥
+	ErrSigningKeyNotFound = errors.New("not found openpgp private key")
+	// ErrInvalidSignature 签名格式错误或者不支持
+	ErrInvalidSignature = errors.New("invalid ssh signature")
+)
+
+// Signer commit和annotated tag的签名器
+type Signer interface {
+	// Sign 对message签名，返回armored格式的签名
+	Sign(message io.Reader) (string, error)
+}
+
+type openPGPSigner struct {
+	entity *openpgp.Entity
+}
+
+// NewOpenPGPSigner 通过OpenPGP armored私钥创建签名器，若私钥已加密，则使用passphrase解密
+func NewOpenPGPSigner(armoredKey, passphrase string) (Signer, error) {
+	el, err := openpgp.ReadArmoredKeyRing(strings.NewReader(armoredKey))
+	if err != nil {
+		return nil, err
+	}
+	if len(el) == 0 || el[0].PrivateKey == nil {
+		return nil, ErrSigningKeyNotFound
+	}
+	entity := el[0]
+	if entity.PrivateKey.Encrypted {
+		if err = entity.PrivateKey.Decrypt([]byte(passphrase)); err != nil {
+			return nil, err
+		}
+	}
+	for _, sub := range entity.Subkeys {
+		if sub.PrivateKey != nil && sub.PrivateKey.Encrypted {
+			if err = sub.PrivateKey.Decrypt([]byte(passphrase)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &openPGPSigner{entity: entity}, nil
+}
+
+func (s *openPGPSigner) Sign(message io.Reader) (string, error) {
+	var b bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&b, s.entity, message, nil); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+const (
+	sshSigMagic         = "SSHSIG"
+	sshSigVersion       = 1
+	sshSigNamespace     = "git"
+	sshSigHashAlgorithm = "sha512"
+	sshSigPemType       = "SSH SIGNATURE"
+	sshSigBegin         = "-----BEGIN SSH SIGNATURE-----"
+)
+
+// sshSigBlob SSHSIG 签名格式，参考 https://github.com/openssh/openssh-portable/blob/master/PROTOCOL.sshsig
+type sshSigBlob struct {
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+// sshSigSignedData SSHSIG 实际被签名的数据
+type sshSigSignedData struct {
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Hash          []byte
+}
+
+func sshSigDataToSign(message io.Reader) ([]byte, error) {
+	h := sha512.New()
+	if _, err := io.Copy(h, message); err != nil {
+		return nil, err
+	}
+	return append([]byte(sshSigMagic), ssh.Marshal(sshSigSignedData{
+		Namespace:     sshSigNamespace,
+		HashAlgorithm: sshSigHashAlgorithm,
+		Hash:          h.Sum(nil),
+	})...), nil
+}
+
+type sshSigner struct {
+	signer ssh.Signer
+}
+
+// NewSSHSigner 通过PEM格式的SSH私钥创建签名器，若私钥已加密，则使用passphrase解密
+func NewSSHSigner(pemBytes []byte, passphrase string) (Signer, error) {
+	var signer ssh.Signer
+	var err error
+	if len(passphrase) > 0 {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(pemBytes, []byte(passphrase))
+	} else {
+		signer, err = ssh.ParsePrivateKey(pemBytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sshSigner{signer: signer}, nil
+}
+
+func (s *sshSigner) Sign(message io.Reader) (string, error) {
+	data, err := sshSigDataToSign(message)
+	if err != nil {
+		return "", err
+	}
+	var sig *ssh.Signature
+	if as, ok := s.signer.(ssh.AlgorithmSigner); ok && s.signer.PublicKey().Type() == ssh.KeyAlgoRSA {
+		sig, err = as.SignWithAlgorithm(rand.Reader, data, ssh.SigAlgoRSASHA2512)
+	} else {
+		sig, err = s.signer.Sign(rand.Reader, data)
+	}
+	if err != nil {
+		return "", err
+	}
+	blob := append([]byte(sshSigMagic), ssh.Marshal(sshSigBlob{
+		Version:       sshSigVersion,
+		PublicKey:     s.signer.PublicKey().Marshal(),
+		Namespace:     sshSigNamespace,
+		HashAlgorithm: sshSigHashAlgorithm,
+		Signature:     ssh.Marshal(sig),
+	})...)
+	return string(pem.EncodeToMemory(&pem.Block{Type: sshSigPemType, Bytes: blob})), nil
+}
+
+func verifySSHSignature(allowedSigners []string, signature string, message io.Reader) error {
+	block, _ := pem.Decode([]byte(signature))
+	if block == nil || block.Type != sshSigPemType {
+		return ErrInvalidSignature
+	}
+	if !bytes.HasPrefix(block.Bytes, []byte(sshSigMagic)) {
+		return fmt.Errorf("%w: magic", ErrInvalidSignature)
+	}
+	var blob sshSigBlob
+	if err := ssh.Unmarshal(block.Bytes[len(sshSigMagic):], &blob); err != nil {
+		return err
+	}
+	if blob.Version != sshSigVersion || blob.Namespace != sshSigNamespace || blob.HashAlgorithm != sshSigHashAlgorithm {
+		return fmt.Errorf("%w, unsupported version: %d, namespace: %s, hash: %s", ErrInvalidSignature, blob.Version, blob.Namespace, blob.HashAlgorithm)
+	}
+	pub, err := ssh.ParsePublicKey(blob.PublicKey)
+	if err != nil {
+		return err
+	}
+	var allowed bool
+	for _, v := range allowedSigners {
+		var ak ssh.PublicKey
+		if ak, _, _, _, err = ssh.ParseAuthorizedKey([]byte(v)); err != nil {
+			return err
+		}
+		if bytes.Equal(ak.Marshal(), pub.Marshal()) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return ErrSignerNotAllowed
+	}
+	sig := new(ssh.Signature)
+	if err = ssh.Unmarshal(blob.Signature, sig); err != nil {
+		return err
+	}
+	var data []byte
+	if data, err = sshSigDataToSign(message); err != nil {
+		return err
+	}
+	return pub.Verify(data, sig)
+}
+
+// verifySignature 根据签名格式选择OpenPGP或者SSH校验
+func (h *cloner) verifySignature(signature string, message io.Reader) error {
+	if len(signature) == 0 {
+		return ErrNotSigned
+	}
+	if strings.HasPrefix(signature, sshSigBegin) {
+		return verifySSHSignature(h.GetAllowedSigners(), signature, message)
+	}
+	keyRing, err := openpgp.ReadArmoredKeyRing(strings.NewReader(h.GetVerifyKeyRing()))
+	if err != nil {
+		return err
+	}
+	_, err = openpgp.CheckArmoredDetachedSignature(keyRing, message, strings.NewReader(signature), nil)
+	return err
+}
+
+func encodedReader(encode func(o plumbing.EncodedObject) error) (io.Reader, error) {
+	encoded := &plumbing.MemoryObject{}
+	if err := encode(encoded); err != nil {
+		return nil, err
+	}
+	rd, err := encoded.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rd.Close() }()
+	var bs []byte
+	if bs, err = ioutil.ReadAll(rd); err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(bs), nil
+}
+
+func (r *repository) storeObject(encode func(o plumbing.EncodedObject) error) (plumbing.Hash, error) {
+	obj := r.Storer.NewEncodedObject()
+	if err := encode(obj); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return r.Storer.SetEncodedObject(obj)
+}
+
+// signCommit 对hash对应的commit签名，并将HEAD指向签名后的commit
+func (r *repository) signCommit(hash plumbing.Hash) (plumbing.Hash, error) {
+	commit, err := r.CommitObject(hash)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	var message io.Reader
+	if message, err = encodedReader(commit.EncodeWithoutSignature); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if commit.PGPSignature, err = r.h.GetSigner().Sign(message); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if hash, err = r.storeObject(commit.Encode); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	var head *plumbing.Reference
+	if head, err = r.Storer.Reference(plumbing.HEAD); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	name := plumbing.HEAD
+	if head.Type() != plumbing.HashReference {
+		name = head.Target()
+	}
+	return hash, r.Storer.SetReference(plumbing.NewHashReference(name, hash))
+}
+
+// signTag 对ref指向的annotated tag签名，并将ref指向签名后的tag
+func (r *repository) signTag(ref *plumbing.Reference) (*plumbing.Reference, error) {
+	t, err := r.TagObject(ref.Hash())
+	if err != nil {
+		return nil, err
+	}
+	var message io.Reader
+	if message, err = encodedReader(t.EncodeWithoutSignature); err != nil {
+		return nil, err
+	}
+	if t.PGPSignature, err = r.h.GetSigner().Sign(message); err != nil {
+		return nil, err
+	}
+	var hash plumbing.Hash
+	if hash, err = r.storeObject(t.Encode); err != nil {
+		return nil, err
+	}
+	ref = plumbing.NewHashReference(ref.Name(), hash)
+	return ref, r.Storer.SetReference(ref)
+}
+
+func (r *repository) verifyTag(t *object.Tag) error {
+	// go-git 仅识别PGP签名，SSH签名会保留在Message中
+	if len(t.PGPSignature) == 0 {
+		if i := strings.Index(t.Message, sshSigBegin); i >= 0 {
+			t.Message, t.PGPSignature = t.Message[:i], t.Message[i:]
+		}
+	}
+	message, err := encodedReader(t.EncodeWithoutSignature)
+	if err != nil {
+		return err
+	}
+	return r.h.verifySignature(t.PGPSignature, message)
+}
+
+func (r *repository) verifyCommit(c *object.Commit) error {
+	message, err := encodedReader(c.EncodeWithoutSignature)
+	if err != nil {
+		return err
+	}
+	return r.h.verifySignature(c.PGPSignature, message)
+}
+
+func (r *repository) Verify(ctx context.Context, rev string) (err error) {
+	defer r.lock()()
+	defer r.bind(ctx)()
+	defer func(start time.Time) { r.done(start, &err, "verify", Field{"rev", rev}) }(time.Now())
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	var ref *plumbing.Reference
+	if ref, err = r.Storer.Reference(getTagReferenceName(rev)); err == nil {
+		var t *object.Tag
+		if t, err = r.TagObject(ref.Hash()); err == nil {
+			err = r.verifyTag(t)
+			return
+		}
+		if err != plumbing.ErrObjectNotFound {
+			return
+		}
+	}
+	var hash *plumbing.Hash
+	if hash, err = r.ResolveRevision(plumbing.Revision(rev)); err != nil {
+		return
+	}
+	var c *object.Commit
+	if c, err = r.CommitObject(*hash); err != nil {
+		return
+	}
+	err = r.verifyCommit(c)
+	return
+}
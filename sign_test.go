@@ -0,0 +1,68 @@
+package gittools
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/crypto/ssh"
+	"testing"
+)
+
+func TestSSHSign(t *testing.T) {
+	Convey("ssh sign commit and tag", t, func() {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		So(err, ShouldBeNil)
+		der, err := x509.MarshalECPrivateKey(key)
+		So(err, ShouldBeNil)
+		signer, err := NewSSHSigner(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), "")
+		So(err, ShouldBeNil)
+		pub, err := ssh.NewPublicKey(&key.PublicKey)
+		So(err, ShouldBeNil)
+
+		g, r := newLocalRepository(t, WithSigner(signer), WithAllowedSigners(string(ssh.MarshalAuthorizedKey(pub))))
+		So(r.Verify(context.Background(), "HEAD"), ShouldBeNil)
+		_, err = r.CreateTag(context.Background(), "v0.0.1", "signed tag", "")
+		So(err, ShouldBeNil)
+		So(r.Verify(context.Background(), "v0.0.1"), ShouldBeNil)
+
+		other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		So(err, ShouldBeNil)
+		otherPub, err := ssh.NewPublicKey(&other.PublicKey)
+		So(err, ShouldBeNil)
+		g.ApplyOption(WithAllowedSigners(string(ssh.MarshalAuthorizedKey(otherPub))))
+		So(errors.Is(r.Verify(context.Background(), "HEAD"), ErrSignerNotAllowed), ShouldBeTrue)
+	})
+}
+
+func TestOpenPGPSign(t *testing.T) {
+	Convey("openpgp sign commit", t, func() {
+		entity, err := openpgp.NewEntity("botman", "", "botman@sandwich.com", nil)
+		So(err, ShouldBeNil)
+		var private, public bytes.Buffer
+		w, err := armor.Encode(&private, openpgp.PrivateKeyType, nil)
+		So(err, ShouldBeNil)
+		So(entity.SerializePrivate(w, nil), ShouldBeNil)
+		So(w.Close(), ShouldBeNil)
+		w, err = armor.Encode(&public, openpgp.PublicKeyType, nil)
+		So(err, ShouldBeNil)
+		So(entity.Serialize(w), ShouldBeNil)
+		So(w.Close(), ShouldBeNil)
+
+		signer, err := NewOpenPGPSigner(private.String(), "")
+		So(err, ShouldBeNil)
+		g, r := newLocalRepository(t, WithSigner(signer), WithVerifyKeyRing(public.String()))
+		So(r.Verify(context.Background(), "HEAD"), ShouldBeNil)
+		g.ApplyOption(WithSigner(nil))
+		So(r.RewriteFile(context.Background(), "a.txt", []byte("unsigned")), ShouldBeNil)
+		So(r.Commit(context.Background(), "unsigned"), ShouldBeNil)
+		So(errors.Is(r.Verify(context.Background(), "HEAD"), ErrNotSigned), ShouldBeTrue)
+	})
+}
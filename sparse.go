@@ -0,0 +1,215 @@
+package gittools
+
+import (
+	"context"
+	"errors"
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/util"
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrOutsideSparsePaths 添加或者修改的文件、目录不在sparse checkout的目录中
+var ErrOutsideSparsePaths = errors.New("path outside sparse checkout paths")
+
+// sparseCheckoutFile sparse checkout的目录，与git sparse-checkout相同，位于.git目录下
+const sparseCheckoutFile = "info/sparse-checkout"
+
+// normalizeSparsePaths 将目录统一为a/b/的形式，避免a匹配到ab
+func normalizeSparsePaths(paths []string) []string {
+	var dirs []string
+	for _, p := range paths {
+		p = strings.Trim(path.Clean(strings.ReplaceAll(p, "\\", "/")), "/")
+		if len(p) == 0 || p == "." {
+			// 包含根目录，即checkout所有文件
+			return nil
+		}
+		dirs = append(dirs, p+"/")
+	}
+	return dirs
+}
+
+// loadSparsePaths 读取saveSparsePaths保存的目录，未开启core.sparseCheckout时返回空
+// 仅支持目录，忽略注释、排除规则以及含有通配符的规则
+func loadSparsePaths(r *git.Repository) []string {
+	fs, ok := r.Storer.(interface{ Filesystem() billy.Filesystem })
+	if !ok {
+		return nil
+	}
+	c, err := r.Config()
+	if err != nil || c.Raw.Section("core").Option("sparseCheckout") != "true" {
+		return nil
+	}
+	data, err := util.ReadFile(fs.Filesystem(), sparseCheckoutFile)
+	if err != nil {
+		return nil
+	}
+	var paths []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") || strings.ContainsAny(line, "*?[") {
+			continue
+		}
+		paths = append(paths, line)
+	}
+	return normalizeSparsePaths(paths)
+}
+
+// saveSparsePaths 将sparse checkout的目录写入.git/info/sparse-checkout并设置core.sparseCheckout，之后Open时读取
+// 内存中的Repository不保存
+func (r *repository) saveSparsePaths() error {
+	fs, ok := r.Storer.(interface{ Filesystem() billy.Filesystem })
+	if !ok {
+		return nil
+	}
+	c, err := r.Config()
+	if err != nil {
+		return err
+	}
+	if len(r.sparsePaths) == 0 {
+		c.Raw.Section("core").RemoveOption("sparseCheckout")
+		if err = fs.Filesystem().Remove(sparseCheckoutFile); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return r.SetConfig(c)
+	}
+	var sb strings.Builder
+	for _, p := range r.sparsePaths {
+		sb.WriteString("/" + p + "\n")
+	}
+	if err = util.WriteFile(fs.Filesystem(), sparseCheckoutFile, []byte(sb.String()), 0644); err != nil {
+		return err
+	}
+	c.Raw.Section("core").SetOption("sparseCheckout", "true")
+	return r.SetConfig(c)
+}
+
+// inSparsePaths name是否在sparse checkout的目录中，未开启sparse checkout时总是返回true
+func (r *repository) inSparsePaths(name string) bool {
+	if len(r.sparsePaths) == 0 {
+		return true
+	}
+	name = strings.Trim(path.Clean(strings.ReplaceAll(name, "\\", "/")), "/") + "/"
+	for _, p := range r.sparsePaths {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// clearSkipWorktree 清除index中的skip-worktree标记
+// go-git在存在skip-worktree标记时计算的Status并不正确，因此index中保留所有文件，未checkout的文件通过status过滤
+func (r *repository) clearSkipWorktree() error {
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return err
+	}
+	for _, e := range idx.Entries {
+		e.SkipWorktree = false
+	}
+	return r.Storer.SetIndex(idx)
+}
+
+// resetSparse 将工作区hard reset到hash，仅写出sparse checkout目录中的文件
+func (r *repository) resetSparse(ctx context.Context, workTree *git.Worktree, hash plumbing.Hash) error {
+	if err := r.fetchMissingBlobs(ctx, plumbing.Revision(hash.String())); err != nil {
+		return err
+	}
+	if err := workTree.ResetSparsely(&git.ResetOptions{Commit: hash, Mode: git.HardReset}, r.sparsePaths); err != nil {
+		return err
+	}
+	return r.clearSkipWorktree()
+}
+
+// keepSparseEntries 在f执行后恢复index中sparse checkout目录以外的文件，避免git add -A将未checkout的文件记录为删除
+func (r *repository) keepSparseEntries(f func() error) error {
+	if len(r.sparsePaths) == 0 {
+		return f()
+	}
+	before, err := r.Storer.Index()
+	if err != nil {
+		return err
+	}
+	var outside []*index.Entry
+	for _, e := range before.Entries {
+		if !r.inSparsePaths(e.Name) {
+			outside = append(outside, e)
+		}
+	}
+	if err = f(); err != nil {
+		return err
+	}
+	var idx *index.Index
+	if idx, err = r.Storer.Index(); err != nil {
+		return err
+	}
+	for _, e := range outside {
+		if _, err0 := idx.Entry(e.Name); err0 == index.ErrEntryNotFound {
+			idx.Entries = append(idx.Entries, e)
+		}
+	}
+	sort.Slice(idx.Entries, func(i, j int) bool { return idx.Entries[i].Name < idx.Entries[j].Name })
+	return r.Storer.SetIndex(idx)
+}
+
+// checkoutHead clone时未checkout(sparse checkout或者partial clone)，clone后写出HEAD
+func (r *repository) checkoutHead(ctx context.Context) error {
+	workTree, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+	var head *plumbing.Reference
+	if head, err = r.Head(); err != nil {
+		return err
+	}
+	if err = r.resetSparse(ctx, workTree, head.Hash()); err != nil || len(r.sparsePaths) == 0 {
+		return err
+	}
+	return r.saveSparsePaths()
+}
+
+// status 工作区状态，忽略因sparse checkout未写出到工作区的文件以及已下载的LFS文件
+func (r *repository) status(workTree *git.Worktree) (git.Status, error) {
+	status, err := workTree.Status()
+	if err != nil {
+		return status, err
+	}
+	for k, v := range status {
+		if v.Staging == git.Unmodified && v.Worktree == git.Deleted && !r.inSparsePaths(k) {
+			delete(status, k)
+		}
+	}
+	return status, r.lfsStatus(workTree, status)
+}
+
+func (r *repository) SetSparsePaths(ctx context.Context, paths ...string) (err error) {
+	defer r.lock()()
+	defer func(start time.Time) { r.done(start, &err, "set sparse paths", Field{"paths", paths}) }(time.Now())
+	defer r.acquire(ctx, &err)()
+	if err != nil {
+		return
+	}
+	var workTree *git.Worktree
+	if workTree, err = r.cleanWorkTree(); err != nil {
+		return
+	}
+	var head *plumbing.Reference
+	if head, err = r.Head(); err != nil {
+		return
+	}
+	old := r.sparsePaths
+	r.sparsePaths = normalizeSparsePaths(paths)
+	if err = r.resetSparse(ctx, workTree, head.Hash()); err != nil {
+		r.sparsePaths = old
+		return
+	}
+	err = r.saveSparsePaths()
+	return
+}
@@ -0,0 +1,102 @@
+package gittools
+
+import (
+	"context"
+	"errors"
+	"github.com/go-git/go-billy/v5/util"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestSparseCheckout(t *testing.T) {
+	Convey("sparse checkout", t, func() {
+		ctx := context.Background()
+		g, upstream := newLocalRepository(t)
+		for _, v := range []string{"a/a.txt", "b/b.txt", "b/c/c.txt", "bb/bb.txt"} {
+			So(upstream.RewriteFile(ctx, v, []byte(v)), ShouldBeNil)
+		}
+		So(upstream.Commit(ctx, "files"), ShouldBeNil)
+
+		old := g.ApplyOption(WithSparsePaths("b"))
+		r, err := g.Clone(ctx, upstream.Root(), "")
+		g.ApplyOption(old...)
+		So(err, ShouldBeNil)
+		defer func() { _ = r.RemoveAll() }()
+		wt, err := r.(*repository).Worktree()
+		So(err, ShouldBeNil)
+		fs := wt.Filesystem
+		for _, v := range []string{"b/b.txt", "b/c/c.txt"} {
+			_, err = fs.Stat(v)
+			So(err, ShouldBeNil)
+		}
+		for _, v := range []string{"README.md", "a/a.txt", "bb/bb.txt"} {
+			_, err = fs.Stat(v)
+			So(err, ShouldNotBeNil)
+		}
+		is, err := r.IsClean()
+		So(err, ShouldBeNil)
+		So(is, ShouldBeTrue)
+
+		So(upstream.RewriteFile(ctx, "a/a.txt", []byte("upstream")), ShouldBeNil)
+		So(upstream.RewriteFile(ctx, "b/b.txt", []byte("upstream")), ShouldBeNil)
+		So(upstream.Commit(ctx, "upstream"), ShouldBeNil)
+		sr, err := r.Pull(ctx, "")
+		So(err, ShouldBeNil)
+		So(sr.IsUpdated(), ShouldBeTrue)
+		_, err = fs.Stat("a/a.txt")
+		So(err, ShouldNotBeNil)
+		bs, err := util.ReadFile(fs, "b/b.txt")
+		So(err, ShouldBeNil)
+		So(string(bs), ShouldEqual, "upstream")
+
+		So(r.RewriteFile(ctx, "b/b.txt", []byte("changed")), ShouldBeNil)
+		So(r.AddAll(ctx), ShouldBeNil)
+		So(errors.Is(r.Add(ctx, "a"), ErrOutsideSparsePaths), ShouldBeTrue)
+		So(r.Commit(ctx, "change b"), ShouldBeNil)
+		head, err := r.(*repository).Head()
+		So(err, ShouldBeNil)
+		c, err := r.(*repository).CommitObject(head.Hash())
+		So(err, ShouldBeNil)
+		for _, v := range []string{"README.md", "a/a.txt", "b/b.txt", "bb/bb.txt"} {
+			_, err = c.File(v)
+			So(err, ShouldBeNil)
+		}
+		is, err = r.IsClean()
+		So(err, ShouldBeNil)
+		So(is, ShouldBeTrue)
+
+		So(errors.Is(r.RewriteFile(ctx, "a/a.txt", []byte("a")), ErrOutsideSparsePaths), ShouldBeTrue)
+
+		Convey("reopen without sparse paths", func() {
+			r2, err := g.Open(ctx, r.Root())
+			So(err, ShouldBeNil)
+			is, err := r2.IsClean()
+			So(err, ShouldBeNil)
+			So(is, ShouldBeTrue)
+			So(r2.RewriteFile(ctx, "b/b.txt", []byte("reopened")), ShouldBeNil)
+			So(r2.AddAll(ctx), ShouldBeNil)
+			So(r2.Commit(ctx, "reopened"), ShouldBeNil)
+			head, err := r2.(*repository).Head()
+			So(err, ShouldBeNil)
+			c, err := r2.(*repository).CommitObject(head.Hash())
+			So(err, ShouldBeNil)
+			_, err = c.File("a/a.txt")
+			So(err, ShouldBeNil)
+		})
+
+		So(r.SetSparsePaths(ctx, "a"), ShouldBeNil)
+		_, err = fs.Stat("a/a.txt")
+		So(err, ShouldBeNil)
+		_, err = fs.Stat("b/b.txt")
+		So(err, ShouldNotBeNil)
+
+		So(r.SetSparsePaths(ctx), ShouldBeNil)
+		for _, v := range []string{"README.md", "a/a.txt", "b/b.txt", "bb/bb.txt"} {
+			_, err = fs.Stat(v)
+			So(err, ShouldBeNil)
+		}
+		r2, err := g.Open(ctx, r.Root())
+		So(err, ShouldBeNil)
+		So(r2.(*repository).sparsePaths, ShouldBeEmpty)
+	})
+}
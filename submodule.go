@@ -0,0 +1,165 @@
+package gittools
+
+import (
+	"context"
+	"fmt"
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"path"
+	"sort"
+	"time"
+)
+
+// Submodule submodule的信息以及状态
+type Submodule struct {
+	// Name .gitmodules中submodule的名称
+	Name string
+	// Path submodule相对于根目录的路径
+	Path string
+	// URL submodule的远端地址
+	URL string
+	// Branch .gitmodules中配置的分支
+	Branch string
+	// Initialized 是否已初始化，即.git/config中是否存在该submodule
+	Initialized bool
+	// Expected 父仓库记录的commit
+	Expected string
+	// Current submodule当前HEAD的commit，未初始化或者未checkout时为空
+	Current string
+}
+
+// IsClean submodule当前的commit是否与父仓库记录的一致
+func (s Submodule) IsClean() bool { return s.Expected == s.Current }
+
+// SubmoduleUpdateOptions UpdateSubmodules 的参数
+type SubmoduleUpdateOptions struct {
+	// Paths 仅更新指定路径的submodule，为空则更新所有submodule
+	Paths []string
+	// Init 初始化尚未初始化的submodule，等同于git submodule update --init，否则跳过未初始化的submodule
+	Init bool
+	// Recursive 递归更新嵌套的submodule
+	Recursive bool
+	// NoFetch 不fetch，仅checkout本地已存在的commit
+	NoFetch bool
+	// Depth fetch的深度，为0则获取完整历史
+	Depth int
+}
+
+// submoduleAuth submodule的认证方式，相对路径的submodule与父仓库的origin一致
+func (r *repository) submoduleAuth(url string) (transport.AuthMethod, error) {
+	ep, err := transport.NewEndpoint(url)
+	if err != nil {
+		return nil, err
+	}
+	if ep.Protocol == "file" && !path.IsAbs(ep.Path) {
+		return r.remoteAuth(DefaultRemoteName)
+	}
+	return r.h.authForURL(url)
+}
+
+func (r *repository) Submodules(ctx context.Context) (subs []Submodule, err error) {
+	defer r.lock()()
+	defer r.bind(ctx)()
+	defer func(start time.Time) { r.done(start, &err, "submodules") }(time.Now())
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	var workTree *git.Worktree
+	if workTree, err = r.Worktree(); err != nil {
+		return
+	}
+	var gs git.Submodules
+	if gs, err = workTree.Submodules(); err != nil {
+		return
+	}
+	var c *config.Config
+	if c, err = r.Config(); err != nil {
+		return
+	}
+	for _, s := range gs {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		var status *git.SubmoduleStatus
+		if status, err = s.Status(); err != nil {
+			return
+		}
+		_, initialized := c.Submodules[s.Config().Name]
+		subs = append(subs, Submodule{
+			Name:        s.Config().Name,
+			Path:        s.Config().Path,
+			URL:         s.Config().URL,
+			Branch:      s.Config().Branch,
+			Initialized: initialized,
+			Expected:    hashString(status.Expected),
+			Current:     hashString(status.Current),
+		})
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].Path < subs[j].Path })
+	return
+}
+
+func (r *repository) UpdateSubmodules(ctx context.Context, o SubmoduleUpdateOptions) (err error) {
+	defer r.lock()()
+	defer func(start time.Time) {
+		r.done(start, &err, "update submodules", Field{"paths", o.Paths}, Field{"init", o.Init})
+	}(time.Now())
+	defer r.acquire(ctx, &err)()
+	if err != nil {
+		return
+	}
+	return r.updateSubmodules(ctx, o)
+}
+
+func (r *repository) updateSubmodules(ctx context.Context, o SubmoduleUpdateOptions) (err error) {
+	var workTree *git.Worktree
+	if workTree, err = r.Worktree(); err != nil {
+		return
+	}
+	var gs git.Submodules
+	if gs, err = workTree.Submodules(); err != nil {
+		return
+	}
+	paths := make(map[string]bool, len(o.Paths))
+	for _, p := range o.Paths {
+		paths[p] = false
+	}
+	for _, s := range gs {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		if _, ok := paths[s.Config().Path]; ok {
+			paths[s.Config().Path] = true
+		} else if len(o.Paths) > 0 || !r.inSparsePaths(s.Config().Path) {
+			continue
+		}
+		var auth transport.AuthMethod
+		if auth, err = r.submoduleAuth(s.Config().URL); err != nil {
+			return
+		}
+		opts := &git.SubmoduleUpdateOptions{Init: o.Init, NoFetch: o.NoFetch, Auth: auth, Depth: o.Depth}
+		if o.Recursive {
+			opts.RecurseSubmodules = git.DefaultSubmoduleRecursionDepth
+		}
+		if err = r.h.retry(ctx, "update submodule", func() error { return s.UpdateContext(ctx, opts) }); err == git.ErrSubmoduleNotInitialized && !o.Init {
+			err = nil
+		} else if err != nil {
+			return fmt.Errorf("submodule %s: %w", s.Config().Path, err)
+		}
+	}
+	for p, found := range paths {
+		if !found {
+			return fmt.Errorf("%w: %s", ErrSubmoduleNotFound, p)
+		}
+	}
+	return
+}
+
+// recurseSubmodules 若开启了RecurseSubmodules，初始化并递归更新所有submodule
+func (r *repository) recurseSubmodules(ctx context.Context) error {
+	if !r.h.GetRecurseSubmodules() {
+		return nil
+	}
+	return r.updateSubmodules(ctx, SubmoduleUpdateOptions{Init: true, Recursive: true})
+}
@@ -0,0 +1,94 @@
+package gittools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+// setSubmodule 在parent中添加或者更新path处的submodule，指向sub当前的HEAD
+func setSubmodule(ctx context.Context, parent, sub Repository, path string) error {
+	content := fmt.Sprintf("[submodule \"%s\"]\n\tpath = %s\n\turl = %s\n", path, path, sub.Root())
+	if err := parent.RewriteFile(ctx, ".gitmodules", []byte(content)); err != nil {
+		return err
+	}
+	r := parent.(*repository)
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return err
+	}
+	if _, err = idx.Entry(path); err == nil {
+		_, _ = idx.Remove(path)
+	}
+	idx.Entries = append(idx.Entries, &index.Entry{Name: path, Hash: sub.(*repository).headHash, Mode: filemode.Submodule})
+	if err = r.Storer.SetIndex(idx); err != nil {
+		return err
+	}
+	return parent.Commit(ctx, "submodule "+path)
+}
+
+func TestSubmodule(t *testing.T) {
+	Convey("submodule", t, func() {
+		ctx := context.Background()
+		_, sub := newLocalRepository(t)
+		So(sub.RewriteFile(ctx, "proto.txt", []byte("v1")), ShouldBeNil)
+		So(sub.Commit(ctx, "v1"), ShouldBeNil)
+		g, upstream := newLocalRepository(t)
+		So(setSubmodule(ctx, upstream, sub, "proto"), ShouldBeNil)
+
+		Convey("update submodules", func() {
+			r, err := g.Clone(ctx, upstream.Root(), "")
+			So(err, ShouldBeNil)
+			defer func() { _ = r.RemoveAll() }()
+			subs, err := r.Submodules(ctx)
+			So(err, ShouldBeNil)
+			So(subs, ShouldHaveLength, 1)
+			So(subs[0].Path, ShouldEqual, "proto")
+			So(subs[0].Initialized, ShouldBeFalse)
+			So(subs[0].Expected, ShouldEqual, sub.(*repository).headHash.String())
+			So(subs[0].IsClean(), ShouldBeFalse)
+
+			So(errors.Is(r.UpdateSubmodules(ctx, SubmoduleUpdateOptions{Paths: []string{"none"}}), ErrSubmoduleNotFound), ShouldBeTrue)
+			So(r.UpdateSubmodules(ctx, SubmoduleUpdateOptions{}), ShouldBeNil)
+			subs, err = r.Submodules(ctx)
+			So(err, ShouldBeNil)
+			So(subs[0].Initialized, ShouldBeFalse)
+
+			So(r.UpdateSubmodules(ctx, SubmoduleUpdateOptions{Init: true}), ShouldBeNil)
+			subs, err = r.Submodules(ctx)
+			So(err, ShouldBeNil)
+			So(subs[0].Initialized, ShouldBeTrue)
+			So(subs[0].IsClean(), ShouldBeTrue)
+		})
+
+		Convey("recurse submodules", func() {
+			old := g.ApplyOption(WithRecurseSubmodules(true))
+			defer g.ApplyOption(old...)
+			r, err := g.Clone(ctx, upstream.Root(), "")
+			So(err, ShouldBeNil)
+			defer func() { _ = r.RemoveAll() }()
+			wt, err := r.(*repository).Worktree()
+			So(err, ShouldBeNil)
+			_, err = wt.Filesystem.Stat("proto/proto.txt")
+			So(err, ShouldBeNil)
+
+			So(sub.RewriteFile(ctx, "proto.txt", []byte("v2")), ShouldBeNil)
+			So(sub.Commit(ctx, "v2"), ShouldBeNil)
+			So(setSubmodule(ctx, upstream, sub, "proto"), ShouldBeNil)
+			sr, err := r.Pull(ctx, "")
+			So(err, ShouldBeNil)
+			So(sr.IsUpdated(), ShouldBeTrue)
+			subs, err := r.Submodules(ctx)
+			So(err, ShouldBeNil)
+			So(subs[0].Current, ShouldEqual, sub.(*repository).headHash.String())
+			So(subs[0].IsClean(), ShouldBeTrue)
+			is, err := r.IsClean()
+			So(err, ShouldBeNil)
+			So(is, ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,114 @@
+package gittools
+
+import (
+	"github.com/go-git/go-git/v5/plumbing"
+	"sort"
+	"strings"
+)
+
+// SyncStatus Pull、Push、Fetch的结果状态
+type SyncStatus string
+
+const (
+	// SyncUpToDate 无需更新
+	SyncUpToDate SyncStatus = "up-to-date"
+	// SyncUpdated 已更新
+	SyncUpdated SyncStatus = "updated"
+	// SyncRejected 被远端或者本地校验拒绝，如push时non-fast-forward
+	SyncRejected SyncStatus = "rejected"
+	// SyncDiverged 本地与远端分叉，如pull时无法fast-forward
+	SyncDiverged SyncStatus = "diverged"
+	// SyncUnknown push失败且无法确认远端是否已更新
+	SyncUnknown SyncStatus = "unknown"
+)
+
+// SyncResult Pull、Push、Fetch的结果
+type SyncResult struct {
+	// Status 结果状态
+	Status SyncStatus
+	// Old 操作前当前分支对应ref的hash
+	Old string
+	// New 操作后当前分支对应ref的hash
+	New string
+	// Refs 每个ref的更新结果
+	Refs []RefUpdate
+}
+
+// IsUpToDate 是否无需更新
+func (s *SyncResult) IsUpToDate() bool { return s != nil && s.Status == SyncUpToDate }
+
+// IsUpdated 是否已更新
+func (s *SyncResult) IsUpdated() bool { return s != nil && s.Status == SyncUpdated }
+
+// newSyncResult 根据refs汇总结果，name为当前分支对应的ref
+func newSyncResult(name plumbing.ReferenceName, refs []RefUpdate) *SyncResult {
+	sr := &SyncResult{Status: SyncUpToDate, Refs: refs}
+	for _, u := range refs {
+		if u.Name == name.String() {
+			sr.Old, sr.New = u.Old, u.New
+		}
+		switch u.Status {
+		case RefStatusUpToDate:
+		case RefStatusRejected:
+			sr.Status = SyncRejected
+		case RefStatusUnknown:
+			if sr.Status != SyncRejected {
+				sr.Status = SyncUnknown
+			}
+		default:
+			if sr.Status == SyncUpToDate {
+				sr.Status = SyncUpdated
+			}
+		}
+	}
+	return sr
+}
+
+// snapshotRefs 记录以prefixes开头的ref
+func (r *repository) snapshotRefs(prefixes ...string) (map[plumbing.ReferenceName]plumbing.Hash, error) {
+	iter, err := r.References()
+	if err != nil {
+		return nil, err
+	}
+	refs := make(map[plumbing.ReferenceName]plumbing.Hash)
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference {
+			return nil
+		}
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(ref.Name().String(), prefix) {
+				refs[ref.Name()] = ref.Hash()
+				break
+			}
+		}
+		return nil
+	})
+	return refs, err
+}
+
+// diffRefs 比较前后两次snapshotRefs的结果
+func (r *repository) diffRefs(before, after map[plumbing.ReferenceName]plumbing.Hash) []RefUpdate {
+	var refs []RefUpdate
+	for name, new := range after {
+		old, exists := before[name]
+		u := RefUpdate{Name: name.String(), Old: hashString(old), New: hashString(new)}
+		switch {
+		case old == new:
+			continue
+		case !exists:
+			u.Status = RefStatusCreated
+		case r.isFastForward(old, new):
+			u.Status = RefStatusUpdated
+		default:
+			u.Status = RefStatusForced
+		}
+		refs = append(refs, u)
+	}
+	for name, old := range before {
+		if _, ok := after[name]; !ok {
+			refs = append(refs, RefUpdate{Name: name.String(), Old: hashString(old), Status: RefStatusDeleted})
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Name < refs[j].Name })
+	return refs
+}
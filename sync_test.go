@@ -0,0 +1,54 @@
+package gittools
+
+import (
+	"context"
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestSyncResult(t *testing.T) {
+	Convey("pull, push and fetch results", t, func() {
+		ctx := context.Background()
+		remote := newBareRemote(t)
+		g, r := newLocalRepository(t)
+		So(r.AddRemote(ctx, DefaultRemoteName, remote), ShouldBeNil)
+		sr, err := r.Push(ctx, "")
+		So(err, ShouldBeNil)
+		So(sr.IsUpdated(), ShouldBeTrue)
+		So(sr.Old, ShouldBeEmpty)
+		So(sr.New, ShouldNotBeEmpty)
+		sr, err = r.Push(ctx, "")
+		So(err, ShouldBeNil)
+		So(sr.IsUpToDate(), ShouldBeTrue)
+
+		other, err := g.Clone(ctx, remote, "")
+		So(err, ShouldBeNil)
+		defer func() { _ = other.RemoveAll() }()
+		So(other.RewriteFile(ctx, "other.txt", []byte("other")), ShouldBeNil)
+		So(other.Commit(ctx, "other"), ShouldBeNil)
+		_, err = other.Push(ctx, "")
+		So(err, ShouldBeNil)
+
+		sr, err = r.Fetch(ctx, "")
+		So(err, ShouldBeNil)
+		So(sr.IsUpdated(), ShouldBeTrue)
+		So(sr.Old, ShouldNotEqual, sr.New)
+		sr, err = r.Fetch(ctx, "")
+		So(err, ShouldBeNil)
+		So(sr.IsUpToDate(), ShouldBeTrue)
+
+		So(r.RewriteFile(ctx, "mine.txt", []byte("mine")), ShouldBeNil)
+		So(r.Commit(ctx, "mine"), ShouldBeNil)
+		sr, err = r.Push(ctx, "")
+		So(err, ShouldNotBeNil)
+		So(sr.Status, ShouldEqual, SyncRejected)
+		sr, err = r.Pull(ctx, "")
+		So(errors.Is(err, ErrNonFastForwardUpdate), ShouldBeTrue)
+		So(sr.Status, ShouldEqual, SyncDiverged)
+
+		sr, err = other.Pull(ctx, "")
+		So(err, ShouldBeNil)
+		So(sr.IsUpToDate(), ShouldBeTrue)
+	})
+}
@@ -14,15 +14,33 @@ type base struct {
 	getRefSpecs func() []config.RefSpec
 }
 
-func (b *base) Push(ctx context.Context) error {
-	publicKeys, err := b.r.h.auth()
+func (b *base) Push(ctx context.Context) (err error) {
+	defer b.r.lock()()
+	defer b.r.acquire(ctx, &err)()
 	if err != nil {
+		return
+	}
+	err = b.push(ctx)
+	return
+}
+
+func (b *base) push(ctx context.Context) error {
+	if b.r.h.GetDryRun() {
+		_, err := b.r.dryRunPush(PushOptions{RefSpecs: refSpecStrings(b.getRefSpecs())})
 		return err
 	}
-	return checkErr(b.r.Repository.PushContext(ctx, &git.PushOptions{
-		Auth:     publicKeys,
-		Progress: b.r.h.getProgress(),
-		RefSpecs: b.getRefSpecs(),
+	ctx, cancel := withTimeout(ctx, b.r.h.GetPushTimeout())
+	defer cancel()
+	auth, err := b.r.remoteAuth(DefaultRemoteName)
+	if err != nil {
+		return err
+	}
+	return checkErr(b.r.h.retry(ctx, "push", func() error {
+		return b.r.Repository.PushContext(b.r.h.metered(ctx, "push"), &git.PushOptions{
+			Auth:     auth,
+			Progress: b.r.h.progress(ctx, "push"),
+			RefSpecs: b.getRefSpecs(),
+		})
 	}))
 }
 
@@ -36,7 +54,7 @@ type tag struct {
 	*plumbing.Reference
 }
 
-func newTag(r *repository, ref *plumbing.Reference) Tag {
+func newTag(r *repository, ref *plumbing.Reference) *tag {
 	t := &tag{Reference: ref}
 	t.base = base{r: r, getRefSpecs: t.getRefSpecs}
 	return t
@@ -50,7 +68,26 @@ func (t *tag) getRefSpecs() []config.RefSpec {
 	return []config.RefSpec{config.RefSpec(fmt.Sprintf("+%s:%s", tn, tn))}
 }
 
-func (t *tag) Delete(ctx context.Context) error {
+func (t *tag) Delete(ctx context.Context) (err error) {
+	defer t.r.lock()()
+	defer t.r.acquire(ctx, &err)()
+	if err != nil {
+		return
+	}
+	err = t.delete(ctx)
+	return
+}
+
+// delete 删除本地标签并标记为删除，dry run时保留本地标签，仅在Push时输出将要删除的远端标签
+func (t *tag) delete(ctx context.Context) error {
+	if t.r.h.GetDryRun() {
+		return t.base.Delete(ctx)
+	}
+	return t.deleteLocal(ctx)
+}
+
+// deleteLocal 删除本地标签并标记为删除
+func (t *tag) deleteLocal(ctx context.Context) error {
 	err := t.r.Repository.DeleteTag(t.Name().Short())
 	if err == nil {
 		err = t.base.Delete(ctx)
@@ -0,0 +1,68 @@
+package gittools
+
+import (
+	"context"
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTimeout(t *testing.T) {
+	Convey("timeout", t, func() {
+		ctx := context.Background()
+		g, r := newLocalRepository(t)
+
+		Convey("canceled context", func() {
+			canceled, cancel := context.WithCancel(ctx)
+			cancel()
+			So(r.RewriteFile(ctx, "a.txt", []byte("a")), ShouldBeNil)
+			So(errors.Is(r.Add(canceled, "a.txt"), context.Canceled), ShouldBeTrue)
+			So(errors.Is(r.AddAll(canceled), context.Canceled), ShouldBeTrue)
+			So(errors.Is(r.Commit(canceled, "a"), context.Canceled), ShouldBeTrue)
+			_, err := r.IsIgnoreFile(canceled, "a.txt")
+			So(errors.Is(err, context.Canceled), ShouldBeTrue)
+			_, err = g.Open(canceled, r.Root())
+			So(errors.Is(err, context.Canceled), ShouldBeTrue)
+			clean, err := r.IsClean()
+			So(err, ShouldBeNil)
+			So(clean, ShouldBeFalse)
+		})
+
+		Convey("add all", func() {
+			So(r.RewriteFile(ctx, "a.txt", []byte("a")), ShouldBeNil)
+			So(os.Remove(filepath.Join(r.Root(), "README.md")), ShouldBeNil)
+			So(r.AddAll(ctx), ShouldBeNil)
+			So(r.Commit(ctx, "a"), ShouldBeNil)
+			clean, err := r.IsClean()
+			So(err, ShouldBeNil)
+			So(clean, ShouldBeTrue)
+		})
+
+		Convey("push timeout", func() {
+			// 模拟无响应的远端
+			block := make(chan struct{})
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				select {
+				case <-block:
+				case <-req.Context().Done():
+				}
+			}))
+			defer srv.Close()
+			defer close(block)
+			So(r.AddRemote(ctx, DefaultRemoteName, srv.URL+"/repo.git"), ShouldBeNil)
+			old := g.ApplyOption(WithPushTimeout(100*time.Millisecond), WithFetchTimeout(100*time.Millisecond))
+			defer g.ApplyOption(old...)
+			start := time.Now()
+			_, err := r.Push(ctx, DefaultRemoteName)
+			So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+			_, err = r.Fetch(ctx, DefaultRemoteName)
+			So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+			So(time.Since(start), ShouldBeLessThan, 5*time.Second)
+		})
+	})
+}
@@ -0,0 +1,104 @@
+package gittools
+
+import (
+	"context"
+	"net/url"
+	"strings"
+)
+
+// Tracer 为Cloner以及Repository的操作创建span，可适配OpenTelemetry等的Tracer
+type Tracer interface {
+	// Start 从ctx创建名为name的子span，返回的ctx会传递给操作
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span 一次操作对应的span
+type Span interface {
+	// SetAttributes 设置span的属性
+	SetAttributes(fields ...Field)
+	// RecordError 记录操作失败的原因
+	RecordError(err error)
+	// End 结束span
+	End()
+}
+
+type spanKey struct{}
+
+// spanFromContext 返回trace创建的span，不存在时返回nil
+func spanFromContext(ctx context.Context) Span {
+	span, _ := ctx.Value(spanKey{}).(Span)
+	return span
+}
+
+// trace 为op创建名为gittools.<op.Name>的span，记录op、远端地址、ref、操作后的hash以及错误
+func (h *cloner) trace(ctx context.Context, op *Operation, next Handler) error {
+	t := h.GetTracer()
+	if t == nil {
+		return next(ctx, op)
+	}
+	ctx, span := t.Start(ctx, "gittools."+op.Name)
+	defer span.End()
+	ctx = context.WithValue(ctx, spanKey{}, span)
+	fields := []Field{{FieldOp, op.Name}}
+	if u := operationURL(op); len(u) > 0 {
+		fields = append(fields, Field{FieldURL, redactURL(u)})
+	}
+	if len(op.Ref) > 0 {
+		fields = append(fields, Field{FieldRef, op.Ref})
+	}
+	span.SetAttributes(fields...)
+	err := next(ctx, op)
+	r, _ := op.Repository.(*repository)
+	if r == nil {
+		// Clone以及Open的结果
+		r, _ = op.Result.(*repository)
+	}
+	if r != nil {
+		span.SetAttributes(Field{FieldRef, r.ref()}, Field{FieldHash, r.hash()})
+	}
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+// operationURL op访问的远端地址，本地操作返回空
+func operationURL(op *Operation) string {
+	r, ok := op.Repository.(*repository)
+	if !ok {
+		if strings.HasPrefix(op.Name, "Clone") && len(op.Args) > 0 {
+			u, _ := op.Args[0].(string)
+			return u
+		}
+		return ""
+	}
+	var remote string
+	switch op.Name {
+	case "Pull", "Push", "Fetch":
+		remote, _ = op.Args[0].(string)
+	case "PushWithOptions":
+		o, _ := op.Args[0].(PushOptions)
+		remote = o.Remote
+	case "FetchWithOptions":
+		o, _ := op.Args[0].(FetchOptions)
+		remote = o.Remote
+	case "DeleteBranch", "DeleteTag", "Branch.Push", "Tag.Push", "MirrorSync", "LFSPull", "UpdateSubmodules":
+	default:
+		return ""
+	}
+	return r.remoteURL(remote)
+}
+
+// redactURL 移除url中的凭证，http(s)移除全部userinfo(可能是token)，其他协议仅移除密码
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+	if u.Scheme == "http" || u.Scheme == "https" {
+		u.User = nil
+	} else {
+		u.User = url.User(u.User.Username())
+	}
+	return u.String()
+}
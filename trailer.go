@@ -0,0 +1,170 @@
+package gittools
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"fmt"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	TrailerSignedOffBy  = "Signed-off-by"
+	TrailerCoAuthoredBy = "Co-authored-by"
+	TrailerChangeID     = "Change-Id"
+)
+
+// Trailer commit message 尾部的 key: value 信息，如 Signed-off-by: name <email>
+type Trailer struct {
+	Key   string
+	Value string
+}
+
+func (t Trailer) String() string { return fmt.Sprintf("%s: %s", t.Key, t.Value) }
+
+// CommitTemplateData CommitTemplate 渲染时可使用的数据
+type CommitTemplateData struct {
+	// Message Commit传入的comment
+	Message string
+	// Branch 当前分支
+	Branch string
+	// UserName config user.name
+	UserName string
+	// UserEmail config user.email
+	UserEmail string
+}
+
+var trailerRegexp = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9-]*)\s*:\s*(.*)$`)
+
+// splitTrailers 将message拆分为正文和尾部的trailer段落，若最后一个段落不全是trailer，则trailer为空
+func splitTrailers(message string) (body string, trailers []Trailer) {
+	message = strings.TrimRight(message, "\n")
+	idx := strings.LastIndex(message, "\n\n")
+	if idx < 0 {
+		return message, nil
+	}
+	for _, line := range strings.Split(message[idx+2:], "\n") {
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') && len(trailers) > 0 {
+			trailers[len(trailers)-1].Value += " " + strings.TrimSpace(line)
+			continue
+		}
+		m := trailerRegexp.FindStringSubmatch(line)
+		if m == nil {
+			return message, nil
+		}
+		trailers = append(trailers, Trailer{Key: m[1], Value: strings.TrimSpace(m[2])})
+	}
+	return message[:idx], trailers
+}
+
+// ParseTrailers 解析commit message尾部的trailer
+func ParseTrailers(message string) []Trailer {
+	_, trailers := splitTrailers(message)
+	return trailers
+}
+
+// AppendTrailers 将trailers追加到message尾部，已存在的相同trailer不会重复追加
+func AppendTrailers(message string, trailers ...Trailer) string {
+	body, exists := splitTrailers(message)
+	for _, t := range trailers {
+		var found bool
+		for _, e := range exists {
+			if strings.EqualFold(e.Key, t.Key) && e.Value == t.Value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			exists = append(exists, t)
+		}
+	}
+	if len(exists) == 0 {
+		return body + "\n"
+	}
+	var b strings.Builder
+	b.WriteString(body)
+	b.WriteString("\n\n")
+	for _, t := range exists {
+		b.WriteString(t.String())
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func newChangeID(message string) string {
+	var nonce [16]byte
+	_, _ = rand.Read(nonce[:])
+	h := sha1.New()
+	_, _ = fmt.Fprintf(h, "%s\n%d\n%x", message, time.Now().UnixNano(), nonce)
+	return fmt.Sprintf("I%x", h.Sum(nil))
+}
+
+// commitMessage 根据CommitTemplate以及trailer相关配置生成最终的commit message
+func (r *repository) commitMessage(comment string) (string, error) {
+	message := comment
+	if tpl := r.h.GetCommitTemplate(); len(tpl) > 0 {
+		t, err := template.New("commit").Parse(tpl)
+		if err != nil {
+			return "", err
+		}
+		var b bytes.Buffer
+		if err = t.Execute(&b, CommitTemplateData{
+			Message:   comment,
+			Branch:    r.currentRefName.Short(),
+			UserName:  r.userName(),
+			UserEmail: r.userEmail(),
+		}); err != nil {
+			return "", err
+		}
+		message = b.String()
+	}
+	var trailers []Trailer
+	if r.h.GetChangeID() {
+		var has bool
+		for _, t := range ParseTrailers(message) {
+			if strings.EqualFold(t.Key, TrailerChangeID) {
+				has = true
+				break
+			}
+		}
+		if !has {
+			trailers = append(trailers, Trailer{Key: TrailerChangeID, Value: newChangeID(message)})
+		}
+	}
+	for _, v := range r.h.GetCoAuthors() {
+		trailers = append(trailers, Trailer{Key: TrailerCoAuthoredBy, Value: v})
+	}
+	trailers = append(trailers, r.h.GetTrailers()...)
+	if r.h.GetSignOff() {
+		trailers = append(trailers, Trailer{Key: TrailerSignedOffBy, Value: fmt.Sprintf("%s <%s>", r.userName(), r.userEmail())})
+	}
+	if len(trailers) == 0 {
+		return message, nil
+	}
+	return AppendTrailers(message, trailers...), nil
+}
+
+func (r *repository) Trailers(ctx context.Context, rev string) (trailers []Trailer, err error) {
+	defer r.lock()()
+	defer r.bind(ctx)()
+	defer func(start time.Time) { r.done(start, &err, "trailers", Field{"rev", rev}) }(time.Now())
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	var hash *plumbing.Hash
+	if hash, err = r.ResolveRevision(plumbing.Revision(rev)); err != nil {
+		return
+	}
+	var c *object.Commit
+	if c, err = r.CommitObject(*hash); err != nil {
+		return
+	}
+	trailers = ParseTrailers(c.Message)
+	return
+}
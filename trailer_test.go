@@ -0,0 +1,41 @@
+package gittools
+
+import (
+	"context"
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+)
+
+func TestTrailers(t *testing.T) {
+	Convey("parse and append trailers", t, func() {
+		So(ParseTrailers("fix: something"), ShouldBeEmpty)
+		So(ParseTrailers("subject\n\nbody line\nnot a trailer"), ShouldBeEmpty)
+		So(ParseTrailers("subject\n\nbody\n\nReviewed-by: a <a@b.c>\nRefs: #1\n  #2\n"), ShouldResemble, []Trailer{
+			{Key: "Reviewed-by", Value: "a <a@b.c>"},
+			{Key: "Refs", Value: "#1 #2"},
+		})
+		msg := AppendTrailers("subject\n\nRefs: #1\n", Trailer{Key: "Refs", Value: "#1"}, Trailer{Key: TrailerSignedOffBy, Value: "a <a@b.c>"})
+		So(msg, ShouldEqual, "subject\n\nRefs: #1\nSigned-off-by: a <a@b.c>\n")
+	})
+
+	Convey("commit with template and trailers", t, func() {
+		_, r := newLocalRepository(t,
+			WithCommitTemplate("[bot] {{.Message}}"),
+			WithSignOff(true),
+			WithChangeID(true),
+			WithCoAuthors("robin <robin@sandwich.com>"),
+			WithTrailers(Trailer{Key: "Ticket", Value: "GT-1"}),
+		)
+		trailers, err := r.Trailers(context.Background(), "HEAD")
+		So(err, ShouldBeNil)
+		So(len(trailers), ShouldEqual, 4)
+		So(trailers[0].Key, ShouldEqual, TrailerChangeID)
+		So(strings.HasPrefix(trailers[0].Value, "I"), ShouldBeTrue)
+		So(trailers[1:], ShouldResemble, []Trailer{
+			{Key: TrailerCoAuthoredBy, Value: "robin <robin@sandwich.com>"},
+			{Key: "Ticket", Value: "GT-1"},
+			{Key: TrailerSignedOffBy, Value: "botman <botman@sandwich.com>"},
+		})
+	})
+}